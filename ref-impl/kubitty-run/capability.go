@@ -0,0 +1,315 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const capabilityBits = 32
+
+var ErrUnknownCapability = errors.New("unknown capability")
+
+func capabilityNumbers() map[string]int {
+	return map[string]int{
+		"CAP_CHOWN":              unix.CAP_CHOWN,
+		"CAP_DAC_OVERRIDE":       unix.CAP_DAC_OVERRIDE,
+		"CAP_DAC_READ_SEARCH":    unix.CAP_DAC_READ_SEARCH,
+		"CAP_FOWNER":             unix.CAP_FOWNER,
+		"CAP_FSETID":             unix.CAP_FSETID,
+		"CAP_KILL":               unix.CAP_KILL,
+		"CAP_SETGID":             unix.CAP_SETGID,
+		"CAP_SETUID":             unix.CAP_SETUID,
+		"CAP_SETPCAP":            unix.CAP_SETPCAP,
+		"CAP_LINUX_IMMUTABLE":    unix.CAP_LINUX_IMMUTABLE,
+		"CAP_NET_BIND_SERVICE":   unix.CAP_NET_BIND_SERVICE,
+		"CAP_NET_BROADCAST":      unix.CAP_NET_BROADCAST,
+		"CAP_NET_ADMIN":          unix.CAP_NET_ADMIN,
+		"CAP_NET_RAW":            unix.CAP_NET_RAW,
+		"CAP_IPC_LOCK":           unix.CAP_IPC_LOCK,
+		"CAP_IPC_OWNER":          unix.CAP_IPC_OWNER,
+		"CAP_SYS_MODULE":         unix.CAP_SYS_MODULE,
+		"CAP_SYS_RAWIO":          unix.CAP_SYS_RAWIO,
+		"CAP_SYS_CHROOT":         unix.CAP_SYS_CHROOT,
+		"CAP_SYS_PTRACE":         unix.CAP_SYS_PTRACE,
+		"CAP_SYS_PACCT":          unix.CAP_SYS_PACCT,
+		"CAP_SYS_ADMIN":          unix.CAP_SYS_ADMIN,
+		"CAP_SYS_BOOT":           unix.CAP_SYS_BOOT,
+		"CAP_SYS_NICE":           unix.CAP_SYS_NICE,
+		"CAP_SYS_RESOURCE":       unix.CAP_SYS_RESOURCE,
+		"CAP_SYS_TIME":           unix.CAP_SYS_TIME,
+		"CAP_SYS_TTY_CONFIG":     unix.CAP_SYS_TTY_CONFIG,
+		"CAP_MKNOD":              unix.CAP_MKNOD,
+		"CAP_LEASE":              unix.CAP_LEASE,
+		"CAP_AUDIT_WRITE":        unix.CAP_AUDIT_WRITE,
+		"CAP_AUDIT_CONTROL":      unix.CAP_AUDIT_CONTROL,
+		"CAP_SETFCAP":            unix.CAP_SETFCAP,
+		"CAP_MAC_OVERRIDE":       unix.CAP_MAC_OVERRIDE,
+		"CAP_MAC_ADMIN":          unix.CAP_MAC_ADMIN,
+		"CAP_SYSLOG":             unix.CAP_SYSLOG,
+		"CAP_WAKE_ALARM":         unix.CAP_WAKE_ALARM,
+		"CAP_BLOCK_SUSPEND":      unix.CAP_BLOCK_SUSPEND,
+		"CAP_AUDIT_READ":         unix.CAP_AUDIT_READ,
+		"CAP_PERFMON":            unix.CAP_PERFMON,
+		"CAP_BPF":                unix.CAP_BPF,
+		"CAP_CHECKPOINT_RESTORE": unix.CAP_CHECKPOINT_RESTORE,
+	}
+}
+
+// defaultCapabilities returns the capabilities Docker grants to containers by default.
+func defaultCapabilities() []string {
+	return []string{
+		"CAP_CHOWN",
+		"CAP_DAC_OVERRIDE",
+		"CAP_FSETID",
+		"CAP_FOWNER",
+		"CAP_MKNOD",
+		"CAP_NET_RAW",
+		"CAP_SETGID",
+		"CAP_SETUID",
+		"CAP_SETFCAP",
+		"CAP_SETPCAP",
+		"CAP_NET_BIND_SERVICE",
+		"CAP_SYS_CHROOT",
+		"CAP_KILL",
+		"CAP_AUDIT_WRITE",
+	}
+}
+
+func defaultSpecCapabilities() *specCapabilities {
+	return &specCapabilities{
+		Bounding:  defaultCapabilities(),
+		Effective: defaultCapabilities(),
+		Permitted: defaultCapabilities(),
+	}
+}
+
+// capabilityFlags holds --cap-add and --cap-drop of a command line.
+type capabilityFlags struct {
+	add  []string
+	drop []string
+}
+
+func registerCapabilityFlags(flags *flag.FlagSet) *capabilityFlags {
+	capFlags := &capabilityFlags{}
+
+	flags.Func("cap-add", `add a capability to the default set, "ALL" for every capability (repeatable)`, func(value string) error {
+		capFlags.add = append(capFlags.add, normalizeCapability(value))
+
+		return nil
+	})
+	flags.Func("cap-drop", `drop a capability from the default set, "ALL" for every capability (repeatable)`, func(value string) error {
+		capFlags.drop = append(capFlags.drop, normalizeCapability(value))
+
+		return nil
+	})
+
+	return capFlags
+}
+
+// capabilities applies the flags to the default capability set. Drops are applied before adds.
+func (c *capabilityFlags) capabilities() *specCapabilities {
+	caps := []string{}
+
+	if !slices.Contains(c.drop, "CAP_ALL") {
+		for _, name := range defaultCapabilities() {
+			if !slices.Contains(c.drop, name) {
+				caps = append(caps, name)
+			}
+		}
+	}
+
+	for _, name := range c.add {
+		if name == "CAP_ALL" {
+			for all := range capabilityNumbers() {
+				caps = append(caps, all)
+			}
+
+			continue
+		}
+
+		caps = append(caps, name)
+	}
+
+	slices.Sort(caps)
+	caps = slices.Compact(caps)
+
+	return &specCapabilities{Bounding: caps, Effective: caps, Permitted: caps}
+}
+
+func normalizeCapability(name string) string {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+
+	return name
+}
+
+// capabilitySet converts capability names into a bit set, ignoring those unknown to the running kernel.
+func capabilitySet(names []string, lastCap int) (uint64, error) {
+	var set uint64
+
+	for _, name := range names {
+		num, ok := capabilityNumbers()[name]
+		if !ok {
+			return 0, errors.WithStack(fmt.Errorf("%w: %s", ErrUnknownCapability, name))
+		}
+
+		if num <= lastCap {
+			set |= 1 << num
+		}
+	}
+
+	return set, nil
+}
+
+// validate rejects unknown names in any of the sets, which would otherwise fail only after the container has started.
+func (c *specCapabilities) validate() error {
+	for _, names := range [][]string{c.Bounding, c.Effective, c.Permitted, c.Inheritable, c.Ambient} {
+		if _, err := capabilitySet(names, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func lastCapability() (int, error) {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	lastCap, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return lastCap, nil
+}
+
+// allCapabilities returns the numbers of all capabilities the running kernel knows.
+func allCapabilities() ([]uintptr, error) {
+	lastCap, err := lastCapability()
+	if err != nil {
+		return nil, err
+	}
+
+	caps := make([]uintptr, 0, lastCap+1)
+	for num := range lastCap + 1 {
+		caps = append(caps, uintptr(num))
+	}
+
+	return caps, nil
+}
+
+type capabilitySets struct {
+	bounding    uint64
+	effective   uint64
+	permitted   uint64
+	inheritable uint64
+	ambient     uint64
+}
+
+func newCapabilitySets(caps *specCapabilities, lastCap int) (*capabilitySets, error) {
+	sets := &capabilitySets{}
+
+	for _, target := range []struct {
+		set   *uint64
+		names []string
+	}{
+		{set: &sets.bounding, names: caps.Bounding},
+		{set: &sets.effective, names: caps.Effective},
+		{set: &sets.permitted, names: caps.Permitted},
+		{set: &sets.inheritable, names: caps.Inheritable},
+		{set: &sets.ambient, names: caps.Ambient},
+	} {
+		set, err := capabilitySet(target.names, lastCap)
+		if err != nil {
+			return nil, err
+		}
+
+		*target.set = set
+	}
+
+	return sets, nil
+}
+
+// dropBoundingSet limits the bounding set of the current thread.
+// It requires CAP_SETPCAP, so it goes before switching the user and capset(2).
+func dropBoundingSet(caps *specCapabilities) error {
+	lastCap, err := lastCapability()
+	if err != nil {
+		return err
+	}
+
+	sets, err := newCapabilitySets(caps, lastCap)
+	if err != nil {
+		return err
+	}
+
+	for num := range lastCap + 1 {
+		if sets.bounding&(1<<num) == 0 {
+			if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(num), 0, 0, 0); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyCapabilities limits the other capabilities of the current thread. It has to be the last step that needs privileges.
+func applyCapabilities(caps *specCapabilities) error {
+	lastCap, err := lastCapability()
+	if err != nil {
+		return err
+	}
+
+	sets, err := newCapabilitySets(caps, lastCap)
+	if err != nil {
+		return err
+	}
+
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	// Version 3 takes 64 bit sets split into two 32 bit structs.
+	data := [2]unix.CapUserData{}
+
+	for i := range data {
+		data[i] = unix.CapUserData{
+			Effective:   uint32(sets.effective >> (capabilityBits * i)),
+			Permitted:   uint32(sets.permitted >> (capabilityBits * i)),
+			Inheritable: uint32(sets.inheritable >> (capabilityBits * i)),
+		}
+	}
+
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return applyAmbientCapabilities(sets.ambient, lastCap)
+}
+
+// applyAmbientCapabilities raises ambient capabilities, which must also be permitted and inheritable.
+func applyAmbientCapabilities(ambient uint64, lastCap int) error {
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for num := range lastCap + 1 {
+		if ambient&(1<<num) != 0 {
+			if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(num), 0, 0); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
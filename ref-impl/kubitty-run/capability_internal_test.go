@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestCapabilityFlags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		add  []string
+		drop []string
+		want []string
+	}{
+		{name: "default", want: slices.Sorted(slices.Values(defaultCapabilities()))},
+		{
+			name: "drop all and add",
+			add:  []string{"CAP_NET_ADMIN", "CAP_KILL"},
+			drop: []string{"CAP_ALL"},
+			want: []string{"CAP_KILL", "CAP_NET_ADMIN"},
+		},
+		{name: "add after drop", add: []string{"CAP_KILL"}, drop: []string{"CAP_ALL", "CAP_KILL"}, want: []string{"CAP_KILL"}},
+		{name: "add all", add: []string{"CAP_ALL"}, want: slices.Sorted(maps.Keys(capabilityNumbers()))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			caps := (&capabilityFlags{add: tt.add, drop: tt.drop}).capabilities()
+			if !slices.Equal(caps.Bounding, tt.want) || !slices.Equal(caps.Effective, tt.want) || !slices.Equal(caps.Permitted, tt.want) {
+				t.Errorf("capabilities() = %+v, want %v in each set", caps, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		caps    *specCapabilities
+		wantErr bool
+	}{
+		{name: "default", caps: defaultSpecCapabilities()},
+		{name: "empty", caps: &specCapabilities{}},
+		{name: "unknown bounding", caps: &specCapabilities{Bounding: []string{"CAP_KILL", "CAP_FOO"}}, wantErr: true},
+		{name: "unknown ambient", caps: &specCapabilities{Ambient: []string{"KILL"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.caps.validate()
+			if tt.wantErr != errors.Is(err, ErrUnknownCapability) || (!tt.wantErr && err != nil) {
+				t.Errorf("validate() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/k1LoW/errors"
+)
+
+const (
+	cgroupRoot          = "/sys/fs/cgroup"
+	defaultCgroupParent = "kubitty"
+
+	cgroupDirPermission = 0o755
+
+	// defaultCPUPeriod is the default period of cpu.max in microseconds.
+	defaultCPUPeriod = 100000
+	// Constants to convert cgroup v1 cpu.shares ([2, 262144]) into cgroup v2 cpu.weight ([1, 10000]).
+	minCPUShares      = 2
+	cpuSharesRange    = 262142
+	cpuWeightRange    = 9999
+	cgroupRemoveRetry = 100
+	cgroupRemoveWait  = 10 * time.Millisecond
+)
+
+var (
+	ErrCgroupV2Unavailable = errors.New("cgroup v2 is not mounted on " + cgroupRoot)
+	ErrInvalidSwapLimit    = errors.New("memory+swap limit must be set with, and not less than, memory limit")
+	ErrInvalidUnifiedKey   = errors.New("invalid key of unified resources")
+	ErrInvalidCgroupPath   = errors.New("cgroups path must be under the cgroup root and not the parent, and a relative one must stay under the parent")
+	ErrCgroupExists        = errors.New("cgroup already exists")
+)
+
+// cgroup is a cgroup v2 directory, identified by its path relative to the cgroup root.
+type cgroup struct {
+	path string
+}
+
+func cgroupV2Available() bool {
+	_, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers"))
+
+	return err == nil
+}
+
+// cgroupPath resolves linux.cgroupsPath of a spec, falling back to "<default parent>/<name>".
+// The cgroup is killed and removed with the container, so the root and the default parent are rejected.
+// An existing cgroup elsewhere is rejected by create instead.
+func cgroupPath(linux *specLinux, name string) (string, error) {
+	parent := filepath.Join("/", defaultCgroupParent)
+
+	switch {
+	case linux.CgroupsPath == "":
+		return filepath.Join(parent, name), nil
+	case filepath.IsAbs(linux.CgroupsPath):
+		path := filepath.Clean(linux.CgroupsPath)
+		if path == "/" || path == parent {
+			return "", errors.WithStack(fmt.Errorf("%w: %s", ErrInvalidCgroupPath, linux.CgroupsPath))
+		}
+
+		return path, nil
+	default:
+		path := filepath.Join(parent, linux.CgroupsPath)
+		if !strings.HasPrefix(path, parent+"/") {
+			return "", errors.WithStack(fmt.Errorf("%w: %s", ErrInvalidCgroupPath, linux.CgroupsPath))
+		}
+
+		return path, nil
+	}
+}
+
+// setupCgroup creates the cgroup of a container and applies the resource limits of the spec.
+// It returns nil without error if cgroup v2 is unavailable and no limit is requested.
+func setupCgroup(linux *specLinux, name string) (*cgroup, error) {
+	if !cgroupV2Available() {
+		if linux.Resources != nil {
+			return nil, errors.WithStack(ErrCgroupV2Unavailable)
+		}
+
+		return nil, nil //nolint:nilnil // no cgroup is a valid result
+	}
+
+	path, err := cgroupPath(linux, name)
+	if err != nil {
+		return nil, err
+	}
+
+	cg := &cgroup{path: path}
+
+	if err := cg.create(); err != nil {
+		// Rootless containers run without a cgroup unless it's delegated to the user.
+		if rootless() && linux.Resources == nil && errors.Is(err, os.ErrPermission) {
+			return nil, nil //nolint:nilnil // no cgroup is a valid result
+		}
+
+		return nil, err
+	}
+
+	if err := cg.apply(linux.Resources); err != nil {
+		_ = cg.destroy()
+
+		return nil, err
+	}
+
+	// Attaching a BPF program requires CAP_SYS_ADMIN in the initial user namespace.
+	if !rootless() {
+		if err := applyDeviceRules(cg, linux); err != nil {
+			_ = cg.destroy()
+
+			return nil, err
+		}
+	}
+
+	return cg, nil
+}
+
+func (c *cgroup) dir() string {
+	return filepath.Join(cgroupRoot, c.path)
+}
+
+// create creates the cgroup and its missing ancestors.
+// The cgroup itself must not exist, so that destroy never kills processes the container doesn't own.
+func (c *cgroup) create() error {
+	// Controllers have to be enabled in every ancestor to be available in the cgroup.
+	parent := cgroupRoot
+	names := strings.Split(strings.Trim(c.path, "/"), "/")
+
+	for i, name := range names {
+		if err := enableControllers(parent); err != nil {
+			return err
+		}
+
+		parent = filepath.Join(parent, name)
+
+		err := os.Mkdir(parent, cgroupDirPermission)
+		switch {
+		case err == nil, os.IsExist(err) && i < len(names)-1:
+		case os.IsExist(err):
+			return errors.WithStack(fmt.Errorf("%w: %s", ErrCgroupExists, c.path))
+		default:
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// enableControllers delegates every controller available in the cgroup to its children.
+func enableControllers(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	controllers := strings.Fields(string(data))
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	control := "+" + strings.Join(controllers, " +")
+
+	return writeCgroupFile(filepath.Join(dir, "cgroup.subtree_control"), control)
+}
+
+// open returns the directory of the cgroup, to be used with clone3(2) CLONE_INTO_CGROUP.
+func (c *cgroup) open() (*os.File, error) {
+	dir, err := os.Open(c.dir())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return dir, nil
+}
+
+func (c *cgroup) readFile(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir(), name))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (c *cgroup) readUint(name string) (uint64, error) {
+	data, err := c.readFile(name)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := strconv.ParseUint(data, 10, 64)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return value, nil
+}
+
+// readLimit reads a file like memory.max, returning nil if it's "max".
+func (c *cgroup) readLimit(name string) (*uint64, error) {
+	data, err := c.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if data == "max" {
+		return nil, nil //nolint:nilnil // no limit is a valid result
+	}
+
+	value, err := strconv.ParseUint(data, 10, 64)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &value, nil
+}
+
+// processes returns the pids of the processes in the cgroup.
+func (c *cgroup) processes() ([]int, error) {
+	data, err := c.readFile("cgroup.procs")
+	if err != nil {
+		return nil, err
+	}
+
+	pids := []int{}
+
+	for field := range strings.FieldsSeq(data) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		pids = append(pids, pid)
+	}
+
+	return pids, nil
+}
+
+// readKeyedFile reads a flat keyed file like cpu.stat, whose lines are in the form of "KEY VALUE".
+func (c *cgroup) readKeyedFile(name string) (map[string]uint64, error) {
+	data, err := c.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]uint64{}
+
+	for line := range strings.Lines(data) {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+
+		if values[key], err = strconv.ParseUint(value, 10, 64); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return values, nil
+}
+
+func (c *cgroup) writeFile(name, value string) error {
+	return writeCgroupFile(filepath.Join(c.dir(), name), value)
+}
+
+// writeCgroupFile writes a cgroup interface file, which must not be created by os.WriteFile.
+func writeCgroupFile(path, value string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(value); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (c *cgroup) apply(resources *specResources) error {
+	files, err := cgroupFiles(resources)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := c.writeFile(file.name, file.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// destroy kills all processes left in the cgroup and removes it.
+func (c *cgroup) destroy() error {
+	// cgroup.kill is available since Linux 5.14.
+	if err := c.writeFile("cgroup.kill", "1"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// Removal fails with EBUSY until all the killed processes have exited.
+	var err error
+
+	for range cgroupRemoveRetry {
+		err = os.Remove(c.dir())
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+
+		time.Sleep(cgroupRemoveWait)
+	}
+
+	return errors.WithStack(err)
+}
+
+type cgroupFile struct {
+	name  string
+	value string
+}
+
+// cgroupFiles converts OCI resources into the values of cgroup v2 interface files, in the order to be written.
+func cgroupFiles(resources *specResources) ([]cgroupFile, error) {
+	files := []cgroupFile{}
+	if resources == nil {
+		return files, nil
+	}
+
+	memoryFiles, err := memoryCgroupFiles(resources.Memory)
+	if err != nil {
+		return nil, err
+	}
+
+	files = append(files, memoryFiles...)
+	files = append(files, cpuCgroupFiles(resources.CPU)...)
+
+	if resources.Pids != nil {
+		files = append(files, cgroupFile{name: "pids.max", value: limitValue(resources.Pids.Limit)})
+	}
+
+	files = append(files, ioCgroupFiles(resources.BlockIO)...)
+
+	// Unified resources are written last, so that they can override the converted values.
+	for key, value := range resources.Unified {
+		if strings.Contains(key, "/") {
+			return nil, errors.WithStack(ErrInvalidUnifiedKey)
+		}
+
+		files = append(files, cgroupFile{name: key, value: value})
+	}
+
+	return files, nil
+}
+
+func memoryCgroupFiles(memory *specMemory) ([]cgroupFile, error) {
+	files := []cgroupFile{}
+	if memory == nil {
+		return files, nil
+	}
+
+	if memory.Limit != nil {
+		files = append(files, cgroupFile{name: "memory.max", value: limitValue(*memory.Limit)})
+	}
+
+	if memory.Swap != nil {
+		// cgroup v2 limits swap separately from memory.
+		switch {
+		case *memory.Swap == -1:
+			files = append(files, cgroupFile{name: "memory.swap.max", value: "max"})
+		case memory.Limit == nil || *memory.Limit < 0 || *memory.Swap < *memory.Limit:
+			return nil, errors.WithStack(ErrInvalidSwapLimit)
+		default:
+			files = append(files, cgroupFile{name: "memory.swap.max", value: strconv.FormatInt(*memory.Swap-*memory.Limit, 10)})
+		}
+	}
+
+	return files, nil
+}
+
+func cpuCgroupFiles(cpu *specCPU) []cgroupFile {
+	files := []cgroupFile{}
+	if cpu == nil {
+		return files
+	}
+
+	if cpu.Shares != nil && *cpu.Shares != 0 {
+		weight := 1 + ((max(*cpu.Shares, minCPUShares)-minCPUShares)*cpuWeightRange)/cpuSharesRange
+		files = append(files, cgroupFile{name: "cpu.weight", value: strconv.FormatUint(weight, 10)})
+	}
+
+	if cpu.Quota != nil || cpu.Period != nil {
+		quota := "max"
+		if cpu.Quota != nil && *cpu.Quota > 0 {
+			quota = strconv.FormatInt(*cpu.Quota, 10)
+		}
+
+		period := uint64(defaultCPUPeriod)
+		if cpu.Period != nil && *cpu.Period != 0 {
+			period = *cpu.Period
+		}
+
+		files = append(files, cgroupFile{name: "cpu.max", value: fmt.Sprintf("%s %d", quota, period)})
+	}
+
+	return files
+}
+
+func ioCgroupFiles(blockIO *specBlockIO) []cgroupFile {
+	files := []cgroupFile{}
+	if blockIO == nil {
+		return files
+	}
+
+	throttles := []struct {
+		key     string
+		devices []specThrottleDevice
+	}{
+		{key: "rbps", devices: blockIO.ThrottleReadBpsDevice},
+		{key: "wbps", devices: blockIO.ThrottleWriteBpsDevice},
+		{key: "riops", devices: blockIO.ThrottleReadIOPSDevice},
+		{key: "wiops", devices: blockIO.ThrottleWriteIOPSDevice},
+	}
+
+	// Each write to io.max updates only the given keys of the device.
+	for _, throttle := range throttles {
+		for _, device := range throttle.devices {
+			files = append(files, cgroupFile{
+				name:  "io.max",
+				value: fmt.Sprintf("%d:%d %s=%s", device.Major, device.Minor, throttle.key, limitValue(int64(device.Rate))),
+			})
+		}
+	}
+
+	return files
+}
+
+// limitValue formats a limit, where a non-positive value means unlimited.
+func limitValue(limit int64) string {
+	if limit <= 0 {
+		return "max"
+	}
+
+	return strconv.FormatInt(limit, 10)
+}
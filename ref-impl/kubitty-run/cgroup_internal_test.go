@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func pointer[T any](value T) *T {
+	return &value
+}
+
+func TestCgroupPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		cgroupsPath string
+		want        string
+		wantErr     bool
+	}{
+		{name: "default", cgroupsPath: "", want: "/kubitty/abc"},
+		{name: "relative", cgroupsPath: "pod/abc", want: "/kubitty/pod/abc"},
+		{name: "absolute", cgroupsPath: "/system.slice/abc", want: "/system.slice/abc"},
+		{name: "absolute under the parent", cgroupsPath: "/kubitty/pod/abc", want: "/kubitty/pod/abc"},
+		{name: "root", cgroupsPath: "/", wantErr: true},
+		{name: "root with dots", cgroupsPath: "/a/..", wantErr: true},
+		{name: "parent", cgroupsPath: "/kubitty/", wantErr: true},
+		{name: "relative parent", cgroupsPath: ".", wantErr: true},
+		{name: "relative escape", cgroupsPath: "../system.slice", wantErr: true},
+		{name: "relative escape inside", cgroupsPath: "pod/../../abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := cgroupPath(&specLinux{CgroupsPath: tt.cgroupsPath}, "abc")
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCgroupPath) {
+					t.Errorf("cgroupPath(%q) error = %v, want ErrInvalidCgroupPath", tt.cgroupsPath, err)
+				}
+
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Errorf("cgroupPath(%q) = %q, %v, want %q", tt.cgroupsPath, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCgroupFiles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		resources *specResources
+		want      []cgroupFile
+		wantErr   error
+	}{
+		{name: "nil", resources: nil, want: []cgroupFile{}},
+		{
+			name:      "memory",
+			resources: &specResources{Memory: &specMemory{Limit: pointer[int64](1 << 20), Swap: pointer[int64](3 << 20)}},
+			want:      []cgroupFile{{name: "memory.max", value: "1048576"}, {name: "memory.swap.max", value: "2097152"}},
+		},
+		{
+			name:      "unlimited memory",
+			resources: &specResources{Memory: &specMemory{Limit: pointer[int64](-1), Swap: pointer[int64](-1)}},
+			want:      []cgroupFile{{name: "memory.max", value: "max"}, {name: "memory.swap.max", value: "max"}},
+		},
+		{
+			name:      "swap less than memory",
+			resources: &specResources{Memory: &specMemory{Limit: pointer[int64](2 << 20), Swap: pointer[int64](1 << 20)}},
+			wantErr:   ErrInvalidSwapLimit,
+		},
+		{
+			name:      "swap without memory",
+			resources: &specResources{Memory: &specMemory{Swap: pointer[int64](1 << 20)}},
+			wantErr:   ErrInvalidSwapLimit,
+		},
+		{
+			name:      "minimum shares",
+			resources: &specResources{CPU: &specCPU{Shares: pointer[uint64](2)}},
+			want:      []cgroupFile{{name: "cpu.weight", value: "1"}},
+		},
+		{
+			name:      "default shares",
+			resources: &specResources{CPU: &specCPU{Shares: pointer[uint64](1024)}},
+			want:      []cgroupFile{{name: "cpu.weight", value: "39"}},
+		},
+		{
+			name:      "maximum shares",
+			resources: &specResources{CPU: &specCPU{Shares: pointer[uint64](262144)}},
+			want:      []cgroupFile{{name: "cpu.weight", value: "10000"}},
+		},
+		{
+			name:      "shares below the minimum",
+			resources: &specResources{CPU: &specCPU{Shares: pointer[uint64](1)}},
+			want:      []cgroupFile{{name: "cpu.weight", value: "1"}},
+		},
+		{
+			name:      "quota and period",
+			resources: &specResources{CPU: &specCPU{Quota: pointer[int64](50000), Period: pointer[uint64](200000)}},
+			want:      []cgroupFile{{name: "cpu.max", value: "50000 200000"}},
+		},
+		{
+			name:      "quota with the default period",
+			resources: &specResources{CPU: &specCPU{Quota: pointer[int64](50000)}},
+			want:      []cgroupFile{{name: "cpu.max", value: "50000 100000"}},
+		},
+		{
+			name:      "unlimited quota",
+			resources: &specResources{CPU: &specCPU{Quota: pointer[int64](-1)}},
+			want:      []cgroupFile{{name: "cpu.max", value: "max 100000"}},
+		},
+		{
+			name:      "pids",
+			resources: &specResources{Pids: &specPids{Limit: 0}},
+			want:      []cgroupFile{{name: "pids.max", value: "max"}},
+		},
+		{
+			name: "block io",
+			resources: &specResources{BlockIO: &specBlockIO{
+				ThrottleReadBpsDevice:   []specThrottleDevice{{Major: 8, Minor: 0, Rate: 1048576}},
+				ThrottleWriteIOPSDevice: []specThrottleDevice{{Major: 8, Minor: 16, Rate: 0}},
+			}},
+			want: []cgroupFile{{name: "io.max", value: "8:0 rbps=1048576"}, {name: "io.max", value: "8:16 wiops=max"}},
+		},
+		{
+			name:      "unified last",
+			resources: &specResources{Pids: &specPids{Limit: 10}, Unified: map[string]string{"pids.max": "20"}},
+			want:      []cgroupFile{{name: "pids.max", value: "10"}, {name: "pids.max", value: "20"}},
+		},
+		{
+			name:      "unified escaping",
+			resources: &specResources{Unified: map[string]string{"../cgroup.procs": "1"}},
+			wantErr:   ErrInvalidUnifiedKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := cgroupFiles(tt.resources)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("cgroupFiles() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("cgroupFiles() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
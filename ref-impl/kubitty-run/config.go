@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// initSyncFD is the file descriptor number of the sync socket in the init process.
+	// The first entry of exec.Cmd.ExtraFiles is always placed at 3.
+	initSyncFD = 3
+	// execFifoFD is the file descriptor number of the exec FIFO in the init process.
+	execFifoFD = 4
+)
+
+var (
+	ErrInitNotReady      = errors.New("init process exited before getting ready")
+	ErrInitFailed        = errors.New("init process failed")
+	ErrUnexpectedMessage = errors.New("unexpected message on the sync socket")
+)
+
+// containerConfig is passed from the runtime to the init process over the sync socket.
+type containerConfig struct {
+	Spec *spec `json:"spec"`
+	// ExecFifo makes the init process wait for "kubitty-run start" before executing the command.
+	ExecFifo bool `json:"execFifo"`
+	// Exec means the init process has joined the namespaces of an existing container.
+	Exec bool `json:"exec"`
+	// Init keeps the init process as PID 1 of the container, running the command as its child.
+	Init bool `json:"init,omitempty"`
+	// EtcDir holds the generated files to be bind-mounted onto /etc of the rootfs. Empty means none.
+	EtcDir string `json:"etcDir,omitempty"`
+	// Network connects the network namespace of the container to the host. nil means it's left isolated.
+	Network *networkConfig `json:"network,omitempty"`
+}
+
+// syncMessage is exchanged between the runtime and the init process after the config.
+type syncMessage struct {
+	Type string `json:"type"`
+	// State is the state of the container passed to the hooks run by the init process.
+	State *containerState `json:"state,omitempty"`
+	// Error is the cause of the failure reported with syncTypeError.
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	syncTypeReady = "ready"
+	// syncTypeConsole carries the master of the pseudo terminal of the container.
+	syncTypeConsole = "console"
+	// syncTypeCreateRuntime asks the runtime to run createRuntime hooks, which it answers with syncTypeCreateContainer.
+	syncTypeCreateRuntime   = "createRuntime"
+	syncTypeCreateContainer = "createContainer"
+	// syncTypeError reports the failure of the init process before getting ready.
+	syncTypeError = "error"
+)
+
+// sendMessage sends v as a single packet of the sync socket, optionally with a file descriptor.
+func sendMessage(socket *os.File, v any, file *os.File) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var rights []byte
+	if file != nil {
+		rights = unix.UnixRights(int(file.Fd()))
+	}
+
+	if err := unix.Sendmsg(int(socket.Fd()), data, rights, nil, 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// receiveMessage receives a packet of the sync socket into v, with the file descriptor attached if any.
+func receiveMessage(socket *os.File, v any) (*os.File, error) {
+	fd := int(socket.Fd())
+
+	// Peek the size first, since a packet not fitting in the buffer is truncated.
+	size, _, _, _, err := unix.Recvmsg(fd, nil, nil, unix.MSG_PEEK|unix.MSG_TRUNC)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if size == 0 {
+		return nil, errors.WithStack(io.EOF)
+	}
+
+	data := make([]byte, size)
+	oob := make([]byte, unix.CmsgSpace(4)) //nolint:mnd // size of a file descriptor
+
+	n, oobn, _, _, err := unix.Recvmsg(fd, data, oob, 0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	file, err := parseRights(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data[:n], v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return file, nil
+}
+
+func parseRights(oob []byte) (*os.File, error) {
+	if len(oob) == 0 {
+		return nil, nil //nolint:nilnil // no file is a valid result
+	}
+
+	messages, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	fds, err := unix.ParseUnixRights(&messages[0])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return os.NewFile(uintptr(fds[0]), "received"), nil
+}
+
+func sendConfig(socket *os.File, config *containerConfig) error {
+	return sendMessage(socket, config, nil)
+}
+
+func receiveConfig(socket *os.File) (*containerConfig, error) {
+	config := &containerConfig{}
+	if _, err := receiveMessage(socket, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func sendReady(socket *os.File) error {
+	return sendMessage(socket, syncMessage{Type: syncTypeReady}, nil)
+}
+
+func sendError(socket *os.File, err error) error {
+	return sendMessage(socket, syncMessage{Type: syncTypeError, Error: err.Error()}, nil)
+}
+
+func sendConsole(socket *os.File, console *os.File) error {
+	return sendMessage(socket, syncMessage{Type: syncTypeConsole}, console)
+}
+
+// requestCreateRuntime waits for the runtime to run createRuntime hooks, and returns the state for the hooks that follow.
+func requestCreateRuntime(socket *os.File) (*containerState, error) {
+	if err := sendMessage(socket, syncMessage{Type: syncTypeCreateRuntime}, nil); err != nil {
+		return nil, err
+	}
+
+	message := syncMessage{}
+	if _, err := receiveMessage(socket, &message); err != nil {
+		return nil, err
+	}
+
+	if message.Type != syncTypeCreateContainer {
+		return nil, errors.WithStack(ErrUnexpectedMessage)
+	}
+
+	return message.State, nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	defaultStateRoot = "/run/kubitty"
+	stateFileName    = "state.json"
+	execFifoName     = "exec.fifo"
+
+	stateDirPermission  = 0o711
+	stateFilePermission = 0o600
+)
+
+var (
+	ErrInvalidID        = errors.New("invalid container ID")
+	ErrContainerExists  = errors.New("container already exists")
+	ErrContainerMissing = errors.New("container does not exist")
+	ErrInvalidStatus    = errors.New("operation is not allowed in the current container status")
+	ErrNoCgroup         = errors.New("container has no cgroup")
+)
+
+type containerStatus string
+
+const (
+	// statusCreating is only seen by createRuntime and createContainer hooks.
+	statusCreating containerStatus = "creating"
+	statusCreated  containerStatus = "created"
+	statusRunning  containerStatus = "running"
+	statusPaused   containerStatus = "paused"
+	statusStopped  containerStatus = "stopped"
+)
+
+// containerState follows the state schema of the OCI runtime spec, with some runtime specific fields.
+type containerState struct {
+	OCIVersion  string            `json:"ociVersion"`
+	ID          string            `json:"id"`
+	Status      containerStatus   `json:"status"`
+	Pid         int               `json:"pid,omitempty"`
+	Bundle      string            `json:"bundle"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	PidStartTime uint64    `json:"pidStartTime,omitempty"`
+	Created      time.Time `json:"created"`
+	// CgroupPath is relative to the cgroup root. Empty means the container has no cgroup.
+	CgroupPath string `json:"cgroupPath,omitempty"`
+	// LogPath is the file the output of the container is written to. Empty means it isn't captured.
+	LogPath string `json:"logPath,omitempty"`
+}
+
+// containerLock is an advisory lock on the state directory of a container.
+type containerLock struct {
+	dir *os.File
+}
+
+func validateID(id string) error {
+	// IDs are used as directory names, so anything that can escape the state root is rejected.
+	// The directory of the persistent namespaces shares the state root.
+	if id == namespaceDirName || !regexp.MustCompile(`^[\w][\w.-]*$`).MatchString(id) {
+		return errors.WithStack(ErrInvalidID)
+	}
+
+	return nil
+}
+
+// stateRoot returns the directory to store the states of containers.
+// Rootless containers are stored under the runtime directory of the user instead.
+func stateRoot() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); rootless() && runtimeDir != "" {
+		return filepath.Join(runtimeDir, "kubitty")
+	}
+
+	return defaultStateRoot
+}
+
+func stateDir(id string) string {
+	return filepath.Join(stateRoot(), id)
+}
+
+// createStateDir creates the state directory of a new container, and returns it exclusively locked.
+func createStateDir(id string) (*containerLock, error) {
+	if err := os.MkdirAll(stateRoot(), stateDirPermission); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := os.Mkdir(stateDir(id), stateDirPermission); err != nil {
+		if os.IsExist(err) {
+			return nil, errors.WithStack(ErrContainerExists)
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	return lockContainer(id, unix.LOCK_EX)
+}
+
+// lockContainer blocks until it acquires the lock of the container.
+// how is either unix.LOCK_SH for read-only operations or unix.LOCK_EX for the others.
+func lockContainer(id string, how int) (*containerLock, error) {
+	if err := validateID(id); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.Open(stateDir(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.WithStack(ErrContainerMissing)
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	if err := unix.Flock(int(dir.Fd()), how); err != nil {
+		dir.Close()
+
+		return nil, errors.WithStack(err)
+	}
+
+	return &containerLock{dir: dir}, nil
+}
+
+func (l *containerLock) unlock() {
+	// Closing the last descriptor releases the lock.
+	l.dir.Close()
+}
+
+// withContainer runs fn with the state of the container while holding its lock.
+func withContainer(id string, how int, fn func(state *containerState) error) error {
+	lock, err := lockContainer(id, how)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	// The container may have been deleted while waiting for the lock.
+	state, err := loadState(id)
+	if err != nil {
+		return err
+	}
+
+	return fn(state)
+}
+
+func saveState(state *containerState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Replace the file atomically, so that readers never see a partially written state.
+	tmp := filepath.Join(stateDir(state.ID), stateFileName+".tmp")
+	if err := os.WriteFile(tmp, data, stateFilePermission); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.Rename(tmp, filepath.Join(stateDir(state.ID), stateFileName)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// loadState reads the state of the container, updating its status to reflect the init process.
+// The caller must hold the lock of the container.
+func loadState(id string) (*containerState, error) {
+	data, err := os.ReadFile(filepath.Join(stateDir(id), stateFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.WithStack(ErrContainerMissing)
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	state := &containerState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if state.Status != statusStopped && !processRunning(state.Pid, state.PidStartTime) {
+		state.Status = statusStopped
+	}
+
+	return state, nil
+}
+
+// containerCgroup returns the cgroup of the container, or nil if it has none.
+func containerCgroup(state *containerState) *cgroup {
+	if state.CgroupPath == "" {
+		return nil
+	}
+
+	return &cgroup{path: state.CgroupPath}
+}
+
+// lookupCgroup returns the cgroup of a container for the operations reading or writing its interface files.
+func lookupCgroup(id string) (*cgroup, error) {
+	var cg *cgroup
+
+	if err := withContainer(id, unix.LOCK_SH, func(state *containerState) error {
+		cg = containerCgroup(state)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if cg == nil {
+		return nil, errors.WithStack(ErrNoCgroup)
+	}
+
+	return cg, nil
+}
+
+// destroyCgroup removes the cgroup of the container on a best-effort basis, used to roll back failures.
+func destroyCgroup(state *containerState) {
+	if cg := containerCgroup(state); cg != nil {
+		_ = cg.destroy()
+	}
+}
+
+// listContainerIDs returns the IDs of all containers that have a state directory.
+func listContainerIDs() ([]string, error) {
+	entries, err := os.ReadDir(stateRoot())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	ids := []string{}
+
+	for _, entry := range entries {
+		if entry.IsDir() && validateID(entry.Name()) == nil {
+			ids = append(ids, entry.Name())
+		}
+	}
+
+	return ids, nil
+}
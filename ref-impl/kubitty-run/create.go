@@ -0,0 +1,195 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const execFifoPermission = 0o622
+
+// create sets up a container from an OCI bundle, leaving the user-specified program waiting for "start".
+func create(args []string) error {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	bundle := flags.String("bundle", ".", "path to the OCI bundle directory")
+	consoleSocket := flags.String("console-socket", "", "unix socket to receive the master of the pseudo terminal, when process.terminal is set")
+	etcFiles := flags.Bool("etc-files", false, "generate /etc/hostname, /etc/hosts and /etc/resolv.conf and bind-mount them into the rootfs")
+	logPath := flags.String("log-path", "", "file to write the output of the container to in the CRI log format (default: in the state directory)")
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	id := flags.Arg(0)
+	if err := validateID(id); err != nil {
+		return err
+	}
+
+	bundlePath, err := filepath.Abs(*bundle)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	spec, err := loadSpec(bundlePath)
+	if err != nil {
+		return err
+	}
+
+	// Nobody would be there to relay the terminal after create exits.
+	if spec.Process.Terminal && *consoleSocket == "" {
+		return errors.WithStack(ErrConsoleSocketRequired)
+	}
+
+	logFile, err := absPathOrEmpty(*logPath)
+	if err != nil {
+		return err
+	}
+
+	lock, err := createStateDir(id)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	state := &containerState{
+		OCIVersion:  specVersion,
+		ID:          id,
+		Status:      statusCreated,
+		Bundle:      bundlePath,
+		Annotations: spec.Annotations,
+		Created:     time.Now().UTC(),
+	}
+
+	// The output of a terminal goes to the console socket instead.
+	if !spec.Process.Terminal {
+		state.LogPath = cmp.Or(logFile, filepath.Join(stateDir(id), defaultLogName))
+	}
+
+	if err := initializeContainer(state, spec, *etcFiles, *consoleSocket); err != nil {
+		_ = os.RemoveAll(stateDir(id))
+
+		return err
+	}
+
+	return nil
+}
+
+// absPathOrEmpty makes path absolute, leaving it empty if it's not given.
+func absPathOrEmpty(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return abs, nil
+}
+
+// initializeContainer fills the state directory of a new container and creates it.
+func initializeContainer(state *containerState, spec *spec, etcFiles bool, consoleSocket string) error {
+	// Keep the spec the container was created with, for the processes joining it later.
+	if err := saveSpec(stateDir(state.ID), spec); err != nil {
+		return err
+	}
+
+	config := &containerConfig{Spec: spec, ExecFifo: true}
+
+	if etcFiles {
+		var err error
+
+		if config.EtcDir, err = generateEtcFiles(stateDir(state.ID), spec); err != nil {
+			return err
+		}
+	}
+
+	return createContainer(state, config, consoleSocket)
+}
+
+func createContainer(state *containerState, config *containerConfig, consoleSocket string) error {
+	fifo, err := createExecFifo(state.ID)
+	if err != nil {
+		return err
+	}
+	defer fifo.Close()
+
+	cg, err := setupCgroup(config.Spec.Linux, state.ID)
+	if err != nil {
+		return err
+	}
+
+	if cg != nil {
+		state.CgroupPath = cg.path
+	}
+
+	opts := initOptions{extraFiles: []*os.File{fifo}, cgroup: cg}
+
+	if state.LogPath != "" {
+		if opts.stdio, err = startLogger(state.LogPath); err != nil {
+			destroyCgroup(state)
+
+			return err
+		}
+		// The logger exits once the container, the only one left with the write ends, closes them.
+		defer opts.stdio.close()
+	}
+
+	process, err := startInit(config, opts)
+	if err != nil {
+		destroyCgroup(state)
+
+		return err
+	}
+
+	if err := registerInit(process, state, config.Spec.Hooks, consoleSocket); err != nil {
+		process.kill()
+		destroyCgroup(state)
+
+		return err
+	}
+
+	return nil
+}
+
+// createExecFifo creates the FIFO "kubitty-run start" opens, and returns it opened with O_PATH to be passed to the init process.
+func createExecFifo(id string) (*os.File, error) {
+	fifoPath := filepath.Join(stateDir(id), execFifoName)
+	if err := unix.Mkfifo(fifoPath, execFifoPermission); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	fd, err := unix.Open(fifoPath, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return os.NewFile(uintptr(fd), execFifoName), nil
+}
+
+// registerInit waits for the init process to get ready, and records it in the state of the container.
+func registerInit(process *initProcess, state *containerState, hooks *specHooks, consoleSocket string) error {
+	if err := process.waitReady(hooks, state); err != nil {
+		return err
+	}
+
+	if _, err := process.attachConsole(consoleSocket); err != nil {
+		return err
+	}
+
+	stat, err := readProcStat(process.pid())
+	if err != nil {
+		return err
+	}
+
+	state.Pid = process.pid()
+	state.PidStartTime = stat.startTime
+
+	return saveState(state)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	killPollInterval = 10 * time.Millisecond
+	killTimeout      = 5 * time.Second
+)
+
+var ErrKillTimeout = errors.New("timed out waiting for the container to stop")
+
+// deleteContainer releases the resources of a stopped container.
+func deleteContainer(args []string) error {
+	flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+	force := flags.Bool("force", false, "kill the container if it is still running")
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return withContainer(flags.Arg(0), unix.LOCK_EX, func(state *containerState) error {
+		if state.Status != statusStopped {
+			if !*force {
+				return errors.WithStack(ErrInvalidStatus)
+			}
+
+			if err := killAndWait(state.Pid, state.PidStartTime); err != nil {
+				return err
+			}
+		}
+
+		spec, err := loadSpec(stateDir(state.ID))
+		if err != nil {
+			return err
+		}
+
+		if cg := containerCgroup(state); cg != nil {
+			if err := cg.destroy(); err != nil {
+				return err
+			}
+		}
+
+		if err := os.RemoveAll(stateDir(state.ID)); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if spec.Hooks != nil {
+			runHooksIgnoringErrors(spec.Hooks.Poststop, state)
+		}
+
+		return nil
+	})
+}
+
+func killAndWait(pid int, startTime uint64) error {
+	if err := unix.Kill(pid, unix.SIGKILL); err != nil && !errors.Is(err, unix.ESRCH) {
+		return errors.WithStack(err)
+	}
+
+	for deadline := time.Now().Add(killTimeout); time.Now().Before(deadline); time.Sleep(killPollInterval) {
+		if !processRunning(pid, startTime) {
+			return nil
+		}
+	}
+
+	return errors.WithStack(ErrKillTimeout)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/devices"
+)
+
+const defaultDeviceMode = 0o666
+
+var (
+	ErrInvalidDevice     = errors.New("invalid device")
+	ErrNotDevice         = errors.New("not a device file")
+	ErrInvalidDevicePath = errors.New("device path must be under /dev")
+)
+
+// specDevice is a device node created in the container, in the form of linux.devices in the OCI runtime spec.
+type specDevice struct {
+	// Type is "c" or "u" for an unbuffered character device, "b" for a block device or "p" for a FIFO.
+	Type  string `json:"type"`
+	Path  string `json:"path"`
+	Major int64  `json:"major,omitempty"`
+	Minor int64  `json:"minor,omitempty"`
+	// FileMode holds the permission bits. 0666 if nil.
+	FileMode *uint32 `json:"fileMode,omitempty"`
+	UID      *uint32 `json:"uid,omitempty"`
+	GID      *uint32 `json:"gid,omitempty"`
+	// HostPath is the device file of the host bind-mounted in a user namespace, which is a runtime specific extension.
+	// Empty means the same path as in the container.
+	HostPath string `json:"hostPath,omitempty"`
+}
+
+// defaultDevices returns the device nodes every container gets, which are allowed by devices.DefaultRules.
+func defaultDevices() []specDevice {
+	return []specDevice{
+		{Type: "c", Path: "/dev/null", Major: 1, Minor: 3},
+		{Type: "c", Path: "/dev/zero", Major: 1, Minor: 5},
+		{Type: "c", Path: "/dev/full", Major: 1, Minor: 7},
+		{Type: "c", Path: "/dev/random", Major: 1, Minor: 8},
+		{Type: "c", Path: "/dev/urandom", Major: 1, Minor: 9},
+		{Type: "c", Path: "/dev/tty", Major: 5, Minor: 0},
+	}
+}
+
+// deviceRules returns the rules of the device controller of the container.
+// The default devices and those created in the container are allowed regardless of the rules in the spec.
+func deviceRules(linux *specLinux) []devices.Rule {
+	rules := []devices.Rule{}
+
+	if linux.Resources != nil {
+		rules = append(rules, linux.Resources.Devices...)
+	}
+
+	rules = append(rules, devices.DefaultRules()...)
+
+	for _, device := range linux.Devices {
+		if device.Type == "p" {
+			continue
+		}
+
+		deviceType := devices.TypeChar
+		if device.Type == "b" {
+			deviceType = devices.TypeBlock
+		}
+
+		rules = append(rules, devices.Rule{Allow: true, Type: deviceType, Major: &device.Major, Minor: &device.Minor, Access: "rwm"})
+	}
+
+	return rules
+}
+
+// applyDeviceRules attaches the device filter of the container to its cgroup.
+func applyDeviceRules(cg *cgroup, linux *specLinux) error {
+	program, err := devices.Compile(deviceRules(linux))
+	if err != nil {
+		return err
+	}
+
+	dir, err := cg.open()
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return devices.Attach(dir, program)
+}
+
+// createDevices creates the device nodes in /dev of rootfs.
+// In a user namespace, where mknod(2) is not permitted, the nodes of the host are bind-mounted instead.
+func createDevices(rootfs string, nodes []specDevice, bind bool) error {
+	for _, node := range nodes {
+		path := filepath.Clean(node.Path)
+		if !strings.HasPrefix(path, "/dev/") {
+			return errors.WithStack(ErrInvalidDevicePath)
+		}
+
+		// The parent is resolved within rootfs, so that symbolic links in the image can't place the node on the host.
+		parent, err := openMountPoint(rootfs, filepath.Dir(path), true)
+		if err != nil {
+			return err
+		}
+
+		err = createDevice(parent, filepath.Base(path), node, bind)
+		parent.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createDevice creates the node named name in the directory parent, unless anything is there already.
+func createDevice(parent *os.File, name string, node specDevice, bind bool) error {
+	// The rootfs may have its own /dev instead of a tmpfs.
+	var stat unix.Stat_t
+	if err := unix.Fstatat(int(parent.Fd()), name, &stat, unix.AT_SYMLINK_NOFOLLOW); err == nil {
+		return nil
+	}
+
+	if bind {
+		return bindDevice(parent, name, cmp.Or(node.HostPath, node.Path))
+	}
+
+	return mknodDevice(parent, name, node)
+}
+
+func mknodDevice(parent *os.File, name string, node specDevice) error {
+	var fileType uint32
+
+	switch node.Type {
+	case "c", "u":
+		fileType = unix.S_IFCHR
+	case "b":
+		fileType = unix.S_IFBLK
+	case "p":
+		fileType = unix.S_IFIFO
+	default:
+		return errors.WithStack(ErrInvalidDevice)
+	}
+
+	mode := uint32(defaultDeviceMode)
+	if node.FileMode != nil {
+		mode = *node.FileMode
+	}
+
+	dirfd := int(parent.Fd())
+
+	if err := unix.Mknodat(dirfd, name, fileType|mode, int(unix.Mkdev(uint32(node.Major), uint32(node.Minor)))); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// mknod(2) applies the umask.
+	if err := unix.Fchmodat(dirfd, name, mode, 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if node.UID != nil || node.GID != nil {
+		uid, gid := -1, -1
+		if node.UID != nil {
+			uid = int(*node.UID)
+		}
+
+		if node.GID != nil {
+			gid = int(*node.GID)
+		}
+
+		if err := unix.Fchownat(dirfd, name, uid, gid, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// bindDevice bind-mounts the device file of the host at source onto an empty file named name in parent.
+func bindDevice(parent *os.File, name, source string) error {
+	if err := unix.Mknodat(int(parent.Fd()), name, unix.S_IFREG|defaultDeviceMode, 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	target := fmt.Sprintf("/proc/self/fd/%d/%s", parent.Fd(), name)
+
+	if err := unix.Mount(source, target, "", unix.MS_BIND, ""); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// deviceFromPath describes the device file of the host at hostPath, to be created at containerPath.
+func deviceFromPath(hostPath, containerPath string) (specDevice, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(hostPath, &stat); err != nil {
+		return specDevice{}, errors.WithStack(err)
+	}
+
+	var deviceType string
+
+	switch stat.Mode & unix.S_IFMT {
+	case unix.S_IFCHR:
+		deviceType = "c"
+	case unix.S_IFBLK:
+		deviceType = "b"
+	default:
+		return specDevice{}, errors.WithStack(ErrNotDevice)
+	}
+
+	mode := stat.Mode &^ unix.S_IFMT
+
+	return specDevice{
+		Type:     deviceType,
+		Path:     containerPath,
+		HostPath: hostPath,
+		Major:    int64(unix.Major(stat.Rdev)),
+		Minor:    int64(unix.Minor(stat.Rdev)),
+		FileMode: &mode,
+		UID:      &stat.Uid,
+		GID:      &stat.Gid,
+	}, nil
+}
+
+// deviceFlags is the list of devices of the host given to the container with --device.
+type deviceFlags []specDevice
+
+func registerDeviceFlags(flags *flag.FlagSet) *deviceFlags {
+	devs := &deviceFlags{}
+
+	flags.Func("device", "device of the host in the form of HOST_PATH[:CONTAINER_PATH] to be created in the container (repeatable)",
+		func(value string) error {
+			hostPath, containerPath, ok := strings.Cut(value, ":")
+			if !ok {
+				containerPath = hostPath
+			}
+
+			device, err := deviceFromPath(hostPath, containerPath)
+			if err != nil {
+				return err
+			}
+
+			*devs = append(*devs, device)
+
+			return nil
+		})
+
+	return devs
+}
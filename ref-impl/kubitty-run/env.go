@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/k1LoW/errors"
+)
+
+const (
+	// defaultPath is used to find the command when the environment of the process has no PATH.
+	defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+	executableBits = 0o111
+)
+
+var ErrExecutableNotFound = errors.New("executable file not found in PATH")
+
+// defaultEnv returns the environment of a process started from the command line, instead of the one of the host.
+func defaultEnv(tty bool) []string {
+	env := []string{"PATH=" + defaultPath}
+	if tty {
+		env = append(env, "TERM=xterm")
+	}
+
+	return env
+}
+
+// mergeEnv returns env with variables overridden or added by overrides, both in the form of KEY=VALUE.
+func mergeEnv(env, overrides []string) []string {
+	merged := slices.Clone(env)
+
+	for _, override := range overrides {
+		key, _, _ := strings.Cut(override, "=")
+
+		index := slices.IndexFunc(merged, func(variable string) bool {
+			return strings.HasPrefix(variable, key+"=")
+		})
+		if index < 0 {
+			merged = append(merged, override)
+		} else {
+			merged[index] = override
+		}
+	}
+
+	return merged
+}
+
+// lookPath resolves the command with PATH in env, searching the root filesystem the process sees.
+// Unlike exec.LookPath, it ignores PATH of the runtime.
+func lookPath(file string, env []string) (string, error) {
+	// A path is resolved by execve(2) as is.
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+
+	path := defaultPath
+
+	// getenv(3) returns the first one if a variable is duplicated.
+	for _, variable := range env {
+		if value, ok := strings.CutPrefix(variable, "PATH="); ok {
+			path = value
+
+			break
+		}
+	}
+
+	for _, dir := range filepath.SplitList(path) {
+		// An empty entry means the working directory.
+		if dir == "" {
+			dir = "."
+		}
+
+		candidate := filepath.Join(dir, file)
+
+		info, err := os.Stat(candidate)
+		if err == nil && info.Mode().IsRegular() && info.Mode().Perm()&executableBits != 0 {
+			return candidate, nil
+		}
+	}
+
+	return "", errors.WithStack(fmt.Errorf("%w: %s", ErrExecutableNotFound, file))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const (
+	executablePermission    = 0o755
+	nonExecutablePermission = 0o644
+)
+
+func TestMergeEnv(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		env       []string
+		overrides []string
+		want      []string
+	}{
+		{name: "none", env: []string{"PATH=/bin"}, overrides: nil, want: []string{"PATH=/bin"}},
+		{name: "added", env: []string{"PATH=/bin"}, overrides: []string{"FOO=bar"}, want: []string{"PATH=/bin", "FOO=bar"}},
+		{
+			name:      "overridden in place",
+			env:       []string{"PATH=/bin", "TERM=xterm"},
+			overrides: []string{"PATH=/usr/bin"},
+			want:      []string{"PATH=/usr/bin", "TERM=xterm"},
+		},
+		{name: "prefix of another key", env: []string{"FOOBAR=1"}, overrides: []string{"FOO=2"}, want: []string{"FOOBAR=1", "FOO=2"}},
+		{name: "later override wins", env: nil, overrides: []string{"FOO=1", "FOO=2"}, want: []string{"FOO=2"}},
+		{name: "empty value", env: []string{"FOO=1"}, overrides: []string{"FOO="}, want: []string{"FOO="}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			env := slices.Clone(tt.env)
+
+			if got := mergeEnv(env, tt.overrides); !slices.Equal(got, tt.want) {
+				t.Errorf("mergeEnv(%q, %q) = %q, want %q", tt.env, tt.overrides, got, tt.want)
+			}
+
+			if !slices.Equal(env, tt.env) {
+				t.Errorf("mergeEnv() changed env to %q", env)
+			}
+		})
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	t.Parallel()
+
+	// Only the command in bin is executable, while that in data isn't and that in dir is a directory.
+	root := t.TempDir()
+	bin := filepath.Join(root, "bin")
+	data := filepath.Join(root, "data")
+	dir := filepath.Join(root, "dir")
+
+	for _, path := range []string{bin, data, filepath.Join(dir, "cmd")} {
+		if err := os.MkdirAll(path, executablePermission); err != nil {
+			t.Fatalf("os.MkdirAll() error = %v", err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(bin, "cmd"), nil, executablePermission); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(data, "cmd"), nil, nonExecutablePermission); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		env     []string
+		want    string
+		wantErr bool
+	}{
+		{name: "path as is", file: "./missing", env: nil, want: "./missing"},
+		{name: "not executable skipped", file: "cmd", env: []string{"PATH=" + data + ":" + bin}, want: filepath.Join(bin, "cmd")},
+		{name: "directory skipped", file: "cmd", env: []string{"PATH=" + dir + ":" + bin}, want: filepath.Join(bin, "cmd")},
+		{name: "first path", file: "cmd", env: []string{"PATH=" + data, "PATH=" + bin}, wantErr: true},
+		{name: "not found", file: "missing", env: []string{"PATH=" + bin}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := lookPath(tt.file, tt.env)
+			if tt.wantErr {
+				if !errors.Is(err, ErrExecutableNotFound) {
+					t.Errorf("lookPath(%q, %q) error = %v, want ErrExecutableNotFound", tt.file, tt.env, err)
+				}
+
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Errorf("lookPath(%q, %q) = %q, %v, want %q", tt.file, tt.env, got, err, tt.want)
+			}
+		})
+	}
+}
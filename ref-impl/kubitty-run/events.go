@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	eventOOM  = "oom"
+	eventExit = "exit"
+)
+
+// containerEvent is a line of the JSON stream printed by events.
+type containerEvent struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	// OOMKills is the number of processes killed by the OOM killer since the previous event.
+	OOMKills uint64 `json:"oomKills,omitempty"`
+}
+
+// events prints OOM kills in a container as JSON lines, until no process is left in its cgroup.
+func events(args []string) error {
+	flags := flag.NewFlagSet("events", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	id := flags.Arg(0)
+
+	cg, err := lookupCgroup(id)
+	if err != nil {
+		return err
+	}
+
+	fd, err := watchCgroupEvents(cg)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	return reportEvents(fd, cg, id)
+}
+
+// watchCgroupEvents returns an inotify instance watching the interface files of the cgroup reporting events.
+func watchCgroupEvents(cg *cgroup) (int, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	// Interface files are modified when their values change, so watch them before reading the initial values.
+	// memory.events is missing unless the memory controller is enabled, in which case OOM kills aren't reported.
+	for _, name := range []string{"cgroup.events", "memory.events"} {
+		_, err := unix.InotifyAddWatch(fd, filepath.Join(cg.dir(), name), unix.IN_MODIFY)
+		if err != nil && !errors.Is(err, unix.ENOENT) {
+			unix.Close(fd)
+
+			return 0, errors.WithStack(err)
+		}
+	}
+
+	return fd, nil
+}
+
+// reportEvents prints the events of the cgroup each time the inotify instance fd wakes up, until it's no longer populated.
+func reportEvents(fd int, cg *cgroup, id string) error {
+	encoder := json.NewEncoder(os.Stdout)
+
+	oomKills, err := cg.oomKills()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, unix.SizeofInotifyEvent+unix.NAME_MAX+1)
+
+	for {
+		kills, err := cg.oomKills()
+		if err != nil {
+			return err
+		}
+
+		if kills > oomKills {
+			if err := encoder.Encode(containerEvent{Type: eventOOM, ID: id, Timestamp: time.Now(), OOMKills: kills - oomKills}); err != nil {
+				return errors.WithStack(err)
+			}
+
+			oomKills = kills
+		}
+
+		populated, err := cg.populated()
+		if err != nil {
+			return err
+		}
+
+		if !populated {
+			if err := encoder.Encode(containerEvent{Type: eventExit, ID: id, Timestamp: time.Now()}); err != nil {
+				return errors.WithStack(err)
+			}
+
+			return nil
+		}
+
+		// Only the wakeup matters, since the files are read again anyway.
+		if _, err := unix.Read(fd, buf); err != nil && !errors.Is(err, unix.EINTR) {
+			return errors.WithStack(err)
+		}
+	}
+}
+
+// oomKills returns the number of processes killed by the OOM killer in the cgroup, or 0 without the memory controller.
+func (c *cgroup) oomKills() (uint64, error) {
+	values, err := c.readKeyedFile("memory.events")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return values["oom_kill"], nil
+}
+
+// populated reports whether any process is left in the cgroup or its descendants.
+// A removed cgroup is reported as not populated.
+func (c *cgroup) populated() (bool, error) {
+	values, err := c.readKeyedFile("cgroup.events")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return values["populated"] != 0, nil
+}
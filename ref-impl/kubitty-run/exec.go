@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+var ErrExecUserNamespace = errors.New("exec into a container with a user namespace, including every rootless one, is not supported")
+
+const execUsage = `Usage: kubitty-run exec [flags] ID [--] COMMAND [ARG...]
+
+Run a command in the namespaces and the cgroup of a created or running container.
+
+A container with a user namespace, including every rootless one, can't be exec'd into:
+joining a user namespace requires a single-threaded process, which the runtime written in Go never is.
+
+Flags:
+`
+
+// execContainer runs a new process in the namespaces and the cgroup of a running container, and waits for it to exit.
+// A container with a user namespace is rejected: setns(2) into a user namespace requires a single-threaded process,
+// which neither the runtime nor the init process written in Go can be.
+func execContainer(args []string) error {
+	flags := flag.NewFlagSet("exec", flag.ContinueOnError)
+	env := []string{}
+	tty := flags.Bool("tty", false, "allocate a pseudo terminal for the command")
+	consoleSocket := flags.String("console-socket", "", "unix socket to receive the master of the pseudo terminal, instead of relaying it")
+
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), execUsage)
+		flags.PrintDefaults()
+	}
+
+	flags.Func("env", "environment variable in the form of KEY=VALUE, added to those of the container (repeatable)",
+		func(value string) error {
+			env = append(env, value)
+
+			return nil
+		})
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	command := flags.Args()
+	if len(command) > 0 {
+		command = command[1:]
+	}
+
+	if len(command) > 0 && command[0] == "--" {
+		command = command[1:]
+	}
+
+	if len(command) == 0 {
+		return errors.WithStack(ErrNoCommand)
+	}
+
+	config, opts, err := prepareExec(flags.Arg(0), command, env, *tty)
+	if err != nil {
+		return err
+	}
+	defer closeFiles(opts.namespaces)
+
+	return runInit(config, opts, *consoleSocket)
+}
+
+// prepareExec builds the config of the new process from the spec of the container, and opens its namespaces.
+func prepareExec(id string, command, env []string, tty bool) (*containerConfig, initOptions, error) {
+	var (
+		config *containerConfig
+		opts   initOptions
+	)
+
+	err := withContainer(id, unix.LOCK_SH, func(state *containerState) error {
+		if state.Status != statusCreated && state.Status != statusRunning {
+			return errors.WithStack(ErrInvalidStatus)
+		}
+
+		spec, err := loadSpec(stateDir(id))
+		if err != nil {
+			return err
+		}
+
+		if hasNamespace(spec.Linux.Namespaces, "user") {
+			return errors.WithStack(ErrExecUserNamespace)
+		}
+
+		spec.Process.Terminal = tty
+		spec.Process.Args = command
+		spec.Process.Env = mergeEnv(spec.Process.Env, env)
+
+		// Open the namespaces while holding the lock, so that the pid can't be reused meanwhile.
+		namespaces, err := openNamespaces(state.Pid, spec.Linux.Namespaces)
+		if err != nil {
+			return err
+		}
+
+		config = &containerConfig{Spec: spec, Exec: true}
+		opts = initOptions{cgroup: containerCgroup(state), namespaces: namespaces}
+
+		return nil
+	})
+	if err != nil {
+		return nil, initOptions{}, err
+	}
+
+	return config, opts, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"time"
+
+	"github.com/k1LoW/errors"
+)
+
+var ErrHookFailed = errors.New("hook failed")
+
+// specHooks are the programs run at the points of the lifecycle of the container.
+type specHooks struct {
+	// CreateRuntime runs in the runtime namespace after the namespaces of the container are created.
+	CreateRuntime []specHook `json:"createRuntime,omitempty"`
+	// CreateContainer runs in the container namespace before pivot_root(2).
+	CreateContainer []specHook `json:"createContainer,omitempty"`
+	// StartContainer runs in the container namespace just before the user-specified program is executed.
+	StartContainer []specHook `json:"startContainer,omitempty"`
+	// Poststart runs in the runtime namespace after the user-specified program is started.
+	Poststart []specHook `json:"poststart,omitempty"`
+	// Poststop runs in the runtime namespace after the container is deleted.
+	Poststop []specHook `json:"poststop,omitempty"`
+}
+
+type specHook struct {
+	Path string   `json:"path"`
+	Args []string `json:"args,omitempty"`
+	Env  []string `json:"env,omitempty"`
+	// Timeout is in seconds. nil means no timeout.
+	Timeout *int `json:"timeout,omitempty"`
+}
+
+// validate checks the fields the spec requires of every hook.
+func (h *specHooks) validate() error {
+	for _, hooks := range [][]specHook{h.CreateRuntime, h.CreateContainer, h.StartContainer, h.Poststart, h.Poststop} {
+		for _, hook := range hooks {
+			if hook.Path == "" || (hook.Timeout != nil && *hook.Timeout <= 0) {
+				return errors.WithStack(fmt.Errorf("%w: hook %+v", ErrInvalidSpec, hook))
+			}
+		}
+	}
+
+	return nil
+}
+
+// runHooks runs the hooks in order, stopping at the first failure.
+func runHooks(hooks []specHook, state *containerState) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, hook := range hooks {
+		if err := runHook(hook, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runHooksIgnoringErrors runs all of the hooks, for the points of the lifecycle where a failure only deserves a warning.
+func runHooksIgnoringErrors(hooks []specHook, state *containerState) {
+	for _, hook := range hooks {
+		if err := runHooks([]specHook{hook}, state); err != nil {
+			log.Printf("warning: %v", err)
+		}
+	}
+}
+
+// runHook runs a hook with the state of the container on its stdin.
+func runHook(hook specHook, state []byte) error {
+	ctx := context.Background()
+
+	if hook.Timeout != nil {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(*hook.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	var output bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, hook.Path)
+	if len(hook.Args) > 0 {
+		cmd.Args = hook.Args
+	}
+
+	// Unlike exec.Cmd, a hook without env gets an empty environment.
+	cmd.Env = append([]string{}, hook.Env...)
+	cmd.Stdin = bytes.NewReader(state)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+
+		err = fmt.Errorf("%w: %s: %w", ErrHookFailed, hook.Path, err)
+		if output.Len() > 0 {
+			err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(output.Bytes()))
+		}
+
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	etcDirName        = "etc"
+	etcFilePermission = 0o644
+	hostResolvConf    = "/etc/resolv.conf"
+)
+
+var (
+	ErrUTSNamespaceRequired = errors.New("hostname and domainname require a new UTS namespace")
+	ErrEtcFilesWithoutRoot  = errors.New("/etc files can only be generated for a container with its own root filesystem")
+)
+
+// defaultNameservers replace those only reachable from the network namespace of the host, as Docker does.
+func defaultNameservers() []string {
+	return []string{"8.8.8.8", "8.8.4.4"}
+}
+
+// validateHostname rejects names that would end up changing those of the host.
+func validateHostname(spec *spec) error {
+	if (spec.Hostname != "" || spec.Domainname != "") && !createsNamespace(spec.Linux.Namespaces, "uts") {
+		return errors.WithStack(ErrUTSNamespaceRequired)
+	}
+
+	return nil
+}
+
+// setHostname applies the names of the container to its UTS namespace.
+func setHostname(spec *spec) error {
+	if spec.Hostname != "" {
+		if err := unix.Sethostname([]byte(spec.Hostname)); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if spec.Domainname != "" {
+		if err := unix.Setdomainname([]byte(spec.Domainname)); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// generateEtcFiles writes /etc/hostname, /etc/hosts and /etc/resolv.conf of the container under dir,
+// and returns the directory to be bind-mounted file by file onto /etc of the rootfs.
+func generateEtcFiles(dir string, spec *spec) (string, error) {
+	if spec.Root == nil {
+		return "", errors.WithStack(ErrEtcFilesWithoutRoot)
+	}
+
+	hostname := spec.Hostname
+	if hostname == "" {
+		// The container shares the name of the host without its own.
+		name, err := os.Hostname()
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		hostname = name
+	}
+
+	resolvConf, err := resolvConf(hasNamespace(spec.Linux.Namespaces, "network"))
+	if err != nil {
+		return "", err
+	}
+
+	etcDir := filepath.Join(dir, etcDirName)
+	if err := os.MkdirAll(etcDir, stateDirPermission); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	for name, content := range map[string][]byte{
+		"hostname":    []byte(hostname + "\n"),
+		"hosts":       hosts(hostname, spec.Domainname),
+		"resolv.conf": resolvConf,
+	} {
+		if err := os.WriteFile(filepath.Join(etcDir, name), content, etcFilePermission); err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+
+	return etcDir, nil
+}
+
+func hosts(hostname, domainname string) []byte {
+	names := hostname
+	if domainname != "" {
+		names = fmt.Sprintf("%s.%s %s", hostname, domainname, hostname)
+	}
+
+	// The container has no address of its own yet, so its name resolves to a loopback address as on Debian.
+	return fmt.Appendf(nil, `127.0.0.1	localhost
+::1	localhost ip6-localhost ip6-loopback
+fe00::0	ip6-localnet
+ff00::0	ip6-mcastprefix
+ff02::1	ip6-allnodes
+ff02::2	ip6-allrouters
+127.0.1.1	%s
+`, names)
+}
+
+// resolvConf derives the resolv.conf of the container from that of the host.
+// In a new network namespace, nameservers on the loopback of the host are unreachable and dropped.
+func resolvConf(newNetwork bool) ([]byte, error) {
+	data, err := os.ReadFile(hostResolvConf)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.WithStack(err)
+	}
+
+	if !newNetwork {
+		return data, nil
+	}
+
+	var (
+		out         bytes.Buffer
+		nameservers int
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "nameserver" {
+			if addr, err := netip.ParseAddr(fields[1]); err == nil && addr.IsLoopback() {
+				continue
+			}
+
+			nameservers++
+		}
+
+		out.WriteString(line + "\n")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if nameservers == 0 {
+		for _, nameserver := range defaultNameservers() {
+			fmt.Fprintf(&out, "nameserver %s\n", nameserver)
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// mountEtcFiles bind-mounts every file in etcDir onto the file with the same name in /etc of the rootfs.
+func mountEtcFiles(rootfs, etcDir string) error {
+	entries, err := os.ReadDir(etcDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, entry := range entries {
+		if err := mountInto(rootfs, specMount{
+			Destination: filepath.Join("/", etcDirName, entry.Name()),
+			Type:        "bind",
+			Source:      filepath.Join(etcDir, entry.Name()),
+			Options:     []string{"bind"},
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
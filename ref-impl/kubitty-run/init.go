@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/seccomp"
+)
+
+// initFailureExitCode is the exit code of the init process failing after reporting the error to the runtime.
+const initFailureExitCode = 1
+
+// initContainer runs inside the new namespaces, re-executed by the runtime as "kubitty-run init".
+// It's also used by "kubitty-run exec" to start a process in the namespaces of an existing container.
+func initContainer() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	// The command must not inherit the socket to the runtime.
+	unix.CloseOnExec(initSyncFD)
+
+	// The socket is left open until the process exits, so that the runtime waits for the error to be reported.
+	socket := os.NewFile(initSyncFD, "init-sync")
+
+	command, err := prepareInit(socket)
+	if err != nil {
+		// stderr may go to a log removed with the container, so the runtime reports the error instead.
+		if sendError(socket, err) == nil {
+			return &exitCodeError{code: initFailureExitCode}
+		}
+
+		return err
+	}
+
+	return command.run()
+}
+
+// initCommand is the command of a container, prepared to be executed once the container is started.
+type initCommand struct {
+	config *containerConfig
+	// state is passed to the hooks of the container, nil if the spec has no hooks or the process joins a container.
+	state *containerState
+	// path is the resolved executable of the command.
+	path   string
+	filter []unix.SockFilter
+}
+
+// prepareInit sets up everything that can fail before the runtime is told the container is ready.
+func prepareInit(socket *os.File) (*initCommand, error) {
+	config, err := receiveConfig(socket)
+	if err != nil {
+		return nil, err
+	}
+
+	command := &initCommand{config: config}
+	spec := config.Spec
+
+	// A process joining an existing container finds everything set up already.
+	if !config.Exec {
+		if command.state, err = setupContainer(socket, config); err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.Process == nil || len(spec.Process.Args) == 0 {
+		return nil, errors.WithStack(ErrNoCommand)
+	}
+
+	if err := setupProcess(spec.Process); err != nil {
+		return nil, err
+	}
+
+	if spec.Process.Capabilities != nil {
+		if err := spec.Process.Capabilities.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if command.path, err = lookPath(spec.Process.Args[0], spec.Process.Env); err != nil {
+		return nil, err
+	}
+
+	if spec.Process.Terminal {
+		if err := createConsole(socket); err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.Linux.Seccomp != nil {
+		// Compile before getting ready, so that an invalid profile fails creation.
+		if command.filter, err = seccomp.Compile(spec.Linux.Seccomp); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sendReady(socket); err != nil {
+		return nil, err
+	}
+
+	return command, nil
+}
+
+// run waits for the start of the container, and executes the command with the privileges restricted.
+func (c *initCommand) run() error {
+	process := c.config.Spec.Process
+
+	if c.config.ExecFifo {
+		if err := waitStart(c.start); err != nil {
+			return err
+		}
+	} else if err := c.start(); err != nil {
+		return err
+	}
+
+	if err := restrictPrivileges(process, c.filter); err != nil {
+		return err
+	}
+
+	if c.config.Init {
+		return superviseCommand(c.path, process.Args, process.Env)
+	}
+
+	if err := unix.Exec(c.path, process.Args, process.Env); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// start runs startContainer hooks.
+func (c *initCommand) start() error {
+	hooks := c.config.Spec.Hooks
+	if hooks == nil || c.state == nil {
+		return nil
+	}
+
+	c.state.Status = statusCreated
+
+	return runHooks(hooks.StartContainer, c.state)
+}
+
+// setupContainer prepares the environment of a new container in its namespaces.
+// It returns the state of the container for the hooks, or nil if the spec has no hooks.
+func setupContainer(socket *os.File, config *containerConfig) (*containerState, error) {
+	spec := config.Spec
+
+	if hasNamespace(spec.Linux.Namespaces, "user") {
+		if err := becomeRoot(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := setHostname(spec); err != nil {
+		return nil, err
+	}
+
+	if spec.Root != nil {
+		if err := setupRootfs(spec, config.EtcDir); err != nil {
+			return nil, err
+		}
+	}
+
+	state, err := createRuntime(socket, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.Root != nil {
+		if err := pivotRoot(spec.Root.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sysctls are written through /proc of the container, before readonlyPaths makes /proc/sys read-only.
+	if err := setSysctls(spec.Linux.Sysctl); err != nil {
+		return nil, err
+	}
+
+	if spec.Root != nil {
+		if err := finishRootfs(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// createRuntime lets the runtime set up the container from the host, and then sets up the network and runs createContainer hooks.
+// It returns the state of the container for the hooks, or nil if the spec has no hooks.
+func createRuntime(socket *os.File, config *containerConfig) (*containerState, error) {
+	spec := config.Spec
+
+	var state *containerState
+
+	// The runtime creates the veth pair on the request, since it must be done from the host.
+	if spec.Hooks != nil || config.Network != nil {
+		var err error
+
+		if state, err = requestCreateRuntime(socket); err != nil {
+			return nil, err
+		}
+	}
+
+	// A joined network namespace is already set up by its creator.
+	if createsNamespace(spec.Linux.Namespaces, "network") {
+		if err := setupNetwork(config.Network); err != nil {
+			return nil, err
+		}
+	}
+
+	// The hooks see the root filesystem of the container under its path, before it becomes the root.
+	if spec.Hooks != nil && state != nil {
+		if err := runHooks(spec.Hooks.CreateContainer, state); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// setupProcess applies the attributes of the process which don't need to wait for the start.
+// Raising rlimits and lowering oom_score_adj require privileges, so they go before switching the user.
+func setupProcess(process *specProcess) error {
+	if process.Cwd != "" {
+		if err := unix.Chdir(process.Cwd); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := setRlimits(process.Rlimits); err != nil {
+		return err
+	}
+
+	if process.OOMScoreAdj != nil {
+		if err := setOOMScoreAdj(*process.OOMScoreAdj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createConsole allocates a pseudo terminal for the process, and passes its master to the runtime.
+func createConsole(socket *os.File) error {
+	master, slave, err := openPty()
+	if err != nil {
+		return err
+	}
+	defer slave.Close()
+
+	err = sendConsole(socket, master)
+	master.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return setupConsole(slave)
+}
+
+// restrictPrivileges switches the user, drops capabilities, sets no_new_privs and loads the seccomp filter
+// just before executing the command.
+func restrictPrivileges(process *specProcess, filter []unix.SockFilter) error {
+	// Without no_new_privs, loading a filter requires CAP_SYS_ADMIN, which may be dropped below.
+	if filter != nil && !process.NoNewPrivileges {
+		if err := seccomp.Load(filter); err != nil {
+			return err
+		}
+	}
+
+	if process.Capabilities != nil {
+		if err := dropBoundingSet(process.Capabilities); err != nil {
+			return err
+		}
+	}
+
+	if err := setUser(process.User); err != nil {
+		return err
+	}
+
+	if process.Capabilities != nil {
+		if err := applyCapabilities(process.Capabilities); err != nil {
+			return err
+		}
+	}
+
+	if process.NoNewPrivileges {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return errors.WithStack(err)
+		}
+
+		// Load as late as possible, so that the filter doesn't have to allow the syscalls of the runtime.
+		if filter != nil {
+			if err := seccomp.Load(filter); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// waitStart blocks until "kubitty-run start" opens the exec FIFO for reading, and runs start while it waits.
+// The FIFO stays empty if start fails, so that "kubitty-run start" can tell the failure.
+func waitStart(start func() error) error {
+	// The runtime opened the FIFO with O_PATH, since its path is no longer visible after pivot_root(2).
+	fifo, err := os.OpenFile(fmt.Sprintf("/proc/self/fd/%d", execFifoFD), os.O_WRONLY, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer fifo.Close()
+
+	if err := unix.Close(execFifoFD); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := start(); err != nil {
+		return err
+	}
+
+	if _, err := fifo.Write([]byte{0}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+var ErrUnknownSignal = errors.New("unknown signal")
+
+// kill sends a signal to the init process of a container.
+func kill(args []string) error {
+	flags := flag.NewFlagSet("kill", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	signal := unix.SIGTERM
+
+	if flags.NArg() > 1 {
+		var err error
+
+		signal, err = parseSignal(flags.Arg(1))
+		if err != nil {
+			return err
+		}
+	}
+
+	return withContainer(flags.Arg(0), unix.LOCK_EX, func(state *containerState) error {
+		// Signals sent to a paused container are delivered once it's resumed, except SIGKILL.
+		if state.Status != statusCreated && state.Status != statusRunning && state.Status != statusPaused {
+			return errors.WithStack(ErrInvalidStatus)
+		}
+
+		if err := unix.Kill(state.Pid, signal); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+}
+
+// parseSignal accepts a signal number, or a name with or without the "SIG" prefix.
+func parseSignal(raw string) (syscall.Signal, error) {
+	if num, err := strconv.Atoi(raw); err == nil {
+		if unix.SignalName(syscall.Signal(num)) == "" {
+			return 0, errors.WithStack(ErrUnknownSignal)
+		}
+
+		return syscall.Signal(num), nil
+	}
+
+	name := strings.ToUpper(raw)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	signal := unix.SignalNum(name)
+	if signal == 0 {
+		return 0, errors.WithStack(ErrUnknownSignal)
+	}
+
+	return signal, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+var ErrUnknownFormat = errors.New("unknown output format")
+
+// list prints all containers, persisting the status of those whose init process has gone.
+func list(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	format := flags.String("format", "table", `output format, "table" or "json"`)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	ids, err := listContainerIDs()
+	if err != nil {
+		return err
+	}
+
+	states := []*containerState{}
+
+	for _, id := range ids {
+		err := withContainer(id, unix.LOCK_EX, func(state *containerState) error {
+			states = append(states, state)
+
+			return saveState(state)
+		})
+		// Skip containers deleted or still being created meanwhile.
+		if errors.Is(err, ErrContainerMissing) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	switch *format {
+	case "table":
+		return printStateTable(states)
+	case "json":
+		if err := json.NewEncoder(os.Stdout).Encode(states); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	default:
+		return errors.WithStack(ErrUnknownFormat)
+	}
+}
+
+func printStateTable(states []*containerState) error {
+	const padding = 3
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', 0)
+
+	fmt.Fprintln(writer, "ID\tPID\tSTATUS\tBUNDLE\tCREATED")
+
+	for _, state := range states {
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\t%s\n",
+			state.ID, state.Pid, state.Status, state.Bundle, state.Created.Local().Format(time.RFC3339))
+	}
+
+	if err := writer.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
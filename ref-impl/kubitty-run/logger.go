@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/crilog"
+)
+
+const (
+	defaultLogName    = "container.log"
+	logFilePermission = 0o640
+)
+
+// The logger process receives the pipes of the container and the log file from fd 3.
+const (
+	loggerStdoutFD = 3 + iota
+	loggerStderrFD
+	loggerLogFD
+)
+
+// startLogger starts a logger process which writes the output of a detached container to the log file,
+// and returns the streams to be given to the container.
+// The logger holds an exclusive flock(2) on the log file until the container closes both of its output streams.
+func startLogger(path string) (*stdio, error) {
+	logFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, logFilePermission)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer logFile.Close()
+
+	// flock(2) belongs to the open file description, so the logger inherits it and nobody sees the file unlocked in between.
+	if err := unix.Flock(int(logFile.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer stdoutReader.Close()
+
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		stdoutWriter.Close()
+
+		return nil, errors.WithStack(err)
+	}
+	defer stderrReader.Close()
+
+	streams := &stdio{stdout: stdoutWriter, stderr: stderrWriter}
+
+	if streams.stdin, err = os.Open(os.DevNull); err != nil {
+		streams.close()
+
+		return nil, errors.WithStack(err)
+	}
+
+	cmd := exec.Command("/proc/self/exe", "logger")
+	cmd.ExtraFiles = []*os.File{stdoutReader, stderrReader, logFile}
+	// The logger outlives "kubitty-run create", so it must not receive the signals sent to its terminal.
+	cmd.SysProcAttr = &unix.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		streams.close()
+
+		return nil, errors.WithStack(err)
+	}
+
+	if err := cmd.Process.Release(); err != nil {
+		streams.close()
+
+		return nil, errors.WithStack(err)
+	}
+
+	return streams, nil
+}
+
+func (s *stdio) close() {
+	for _, file := range []*os.File{s.stdin, s.stdout, s.stderr} {
+		if file != nil {
+			file.Close()
+		}
+	}
+}
+
+// runLogger copies the output of the container to the log file in the CRI format, re-executed as "kubitty-run logger".
+func runLogger() error {
+	logFile := os.NewFile(loggerLogFD, "log")
+	defer logFile.Close()
+
+	writer := crilog.NewWriter(logFile)
+
+	var (
+		wg   sync.WaitGroup
+		errs [2]error
+	)
+
+	for i, pipe := range []struct {
+		fd     uintptr
+		stream crilog.Stream
+	}{
+		{fd: loggerStdoutFD, stream: crilog.Stdout},
+		{fd: loggerStderrFD, stream: crilog.Stderr},
+	} {
+		wg.Go(func() {
+			reader := os.NewFile(pipe.fd, string(pipe.stream))
+			defer reader.Close()
+
+			stream := writer.Stream(pipe.stream)
+
+			_, err := io.Copy(stream, reader)
+			errs[i] = errors.Join(err, stream.Close())
+		})
+	}
+
+	wg.Wait()
+
+	return errors.WithStack(errors.Join(errs[:]...))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/crilog"
+)
+
+const followInterval = 100 * time.Millisecond
+
+var ErrNoLog = errors.New("the output of the container is not captured")
+
+// logs prints the output of a detached container from its log file.
+func logs(args []string) error {
+	flags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	follow := flags.Bool("follow", false, "keep printing new output until the container closes its output streams")
+	since := flags.String("since", "", "print only the output after a timestamp in RFC 3339, or a duration like 10m before now")
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	sinceTime, err := parseSince(*since)
+	if err != nil {
+		return err
+	}
+
+	var logPath string
+
+	if err := withContainer(flags.Arg(0), unix.LOCK_SH, func(state *containerState) error {
+		logPath = state.LogPath
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if logPath == "" {
+		return errors.WithStack(ErrNoLog)
+	}
+
+	file, err := os.Open(logPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer file.Close()
+
+	return printLogs(file, sinceTime, *follow)
+}
+
+// parseSince accepts either an absolute time or a duration relative to now. An empty value means the beginning.
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, errors.WithStack(err)
+	}
+
+	return time.Now().Add(-d), nil
+}
+
+// printLogs writes the content of each entry to the stream it came from.
+// When following, it polls for new entries until the logger process exits.
+func printLogs(file *os.File, since time.Time, follow bool) error {
+	reader := crilog.NewReader(file, since)
+	done := false
+
+	for {
+		entry, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			if !follow || done {
+				return nil
+			}
+
+			// Check before reading again, so that the last entries written before the exit aren't missed.
+			if done, err = loggerExited(file); err != nil {
+				return err
+			}
+
+			if !done {
+				time.Sleep(followInterval)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		out := os.Stdout
+		if entry.Stream == crilog.Stderr {
+			out = os.Stderr
+		}
+
+		content := entry.Content
+		if !entry.Partial {
+			content = append(content, '\n')
+		}
+
+		if _, err := out.Write(content); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+}
+
+// loggerExited reports whether the logger process has released its lock on the log file.
+func loggerExited(file *os.File) (bool, error) {
+	err := unix.Flock(int(file.Fd()), unix.LOCK_SH|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return true, nil
+}
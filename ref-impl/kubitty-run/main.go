@@ -1,35 +1,66 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
-	"os/exec"
 
 	"github.com/k1LoW/errors"
-	"golang.org/x/sys/unix"
 )
 
-func main() {
-	switch os.Args[1] {
-	case "run":
-		if err := run(os.Args[2:]); err != nil {
-			log.Fatalln(errors.StackTraces(err))
-		}
+var (
+	ErrNoCommand = errors.New("no command specified")
+	ErrNoID      = errors.New("no container ID specified")
+)
 
-	default:
-		log.Fatalf("unknown command: %s", os.Args[1])
+// exitCodeError carries the exit code of a container process to be propagated to the caller.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func commands() map[string]func(args []string) error {
+	return map[string]func(args []string) error{
+		"run":    run,
+		"create": create,
+		"start":  start,
+		"state":  queryState,
+		"kill":   kill,
+		"delete": deleteContainer,
+		"list":   list,
+		"exec":   execContainer,
+		"logs":   logs,
+		"ps":     ps,
+		"stats":  stats,
+		"events": events,
+		"pause":  pause,
+		"resume": resume,
+		"update": update,
+		"ns":     namespaceCommand,
+		// init and logger are not meant to be called by users.
+		"init":   func([]string) error { return initContainer() },
+		"logger": func([]string) error { return runLogger() },
 	}
 }
 
-func run(command []string) error {
-	path, err := exec.LookPath(command[0])
-	if err != nil {
-		return errors.WithStack(err)
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatalln(ErrNoCommand)
 	}
 
-	if err := unix.Exec(path, command, os.Environ()); err != nil {
-		return errors.WithStack(err)
+	command, ok := commands()[os.Args[1]]
+	if !ok {
+		log.Fatalf("unknown command: %s", os.Args[1])
 	}
 
-	return nil
+	if err := command(os.Args[2:]); err != nil {
+		if exitErr, ok := errors.AsType[*exitCodeError](err); ok {
+			os.Exit(exitErr.code)
+		}
+
+		log.Fatalln(errors.StackTraces(err))
+	}
 }
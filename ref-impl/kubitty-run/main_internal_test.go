@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The runtime executes itself as the init process, which is the test binary in the tests running the runtime.
+	if len(os.Args) > 1 {
+		if _, ok := commands()[os.Args[1]]; ok {
+			main()
+
+			return
+		}
+	}
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	mountPointPermission = 0o755
+	mountFilePermission  = 0o644
+)
+
+var ErrInvalidMount = errors.New("invalid mount")
+
+// specMount is an entry of mounts in the OCI runtime spec.
+type specMount struct {
+	// Destination is the absolute path inside the container.
+	Destination string   `json:"destination"`
+	Type        string   `json:"type,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// mountOptions is the result of parsing the options of a mount.
+type mountOptions struct {
+	flags uintptr
+	// propagation holds the propagation types, each of which needs its own mount(2) after mounting.
+	propagation []uintptr
+	// data is the options unknown to mount(2) itself, passed to the filesystem.
+	data string
+}
+
+// parseMountOptions splits the options of a mount into MS_* flags and the data for the filesystem, as mount(8) does.
+func parseMountOptions(options []string) mountOptions {
+	setFlags := map[string]uintptr{
+		"ro":          unix.MS_RDONLY,
+		"nosuid":      unix.MS_NOSUID,
+		"nodev":       unix.MS_NODEV,
+		"noexec":      unix.MS_NOEXEC,
+		"sync":        unix.MS_SYNCHRONOUS,
+		"dirsync":     unix.MS_DIRSYNC,
+		"remount":     unix.MS_REMOUNT,
+		"mand":        unix.MS_MANDLOCK,
+		"noatime":     unix.MS_NOATIME,
+		"nodiratime":  unix.MS_NODIRATIME,
+		"relatime":    unix.MS_RELATIME,
+		"strictatime": unix.MS_STRICTATIME,
+		"bind":        unix.MS_BIND,
+		"rbind":       unix.MS_BIND | unix.MS_REC,
+	}
+	clearFlags := map[string]uintptr{
+		"rw":            unix.MS_RDONLY,
+		"suid":          unix.MS_NOSUID,
+		"dev":           unix.MS_NODEV,
+		"exec":          unix.MS_NOEXEC,
+		"async":         unix.MS_SYNCHRONOUS,
+		"nomand":        unix.MS_MANDLOCK,
+		"atime":         unix.MS_NOATIME,
+		"diratime":      unix.MS_NODIRATIME,
+		"norelatime":    unix.MS_RELATIME,
+		"nostrictatime": unix.MS_STRICTATIME,
+	}
+	propagation := map[string]uintptr{
+		"private":     unix.MS_PRIVATE,
+		"rprivate":    unix.MS_PRIVATE | unix.MS_REC,
+		"shared":      unix.MS_SHARED,
+		"rshared":     unix.MS_SHARED | unix.MS_REC,
+		"slave":       unix.MS_SLAVE,
+		"rslave":      unix.MS_SLAVE | unix.MS_REC,
+		"unbindable":  unix.MS_UNBINDABLE,
+		"runbindable": unix.MS_UNBINDABLE | unix.MS_REC,
+	}
+
+	var (
+		result mountOptions
+		data   []string
+	)
+
+	for _, option := range options {
+		if flag, ok := setFlags[option]; ok {
+			result.flags |= flag
+		} else if flag, ok := clearFlags[option]; ok {
+			result.flags &^= flag
+		} else if flag, ok := propagation[option]; ok {
+			result.propagation = append(result.propagation, flag)
+		} else if option != "defaults" {
+			data = append(data, option)
+		}
+	}
+
+	result.data = strings.Join(data, ",")
+
+	return result
+}
+
+// mountInto mounts m at its destination under rootfs, creating the mount point if it's missing.
+func mountInto(rootfs string, m specMount) error {
+	if !filepath.IsAbs(m.Destination) {
+		return errors.WithStack(fmt.Errorf("%w: destination %q is not absolute", ErrInvalidMount, m.Destination))
+	}
+
+	options := parseMountOptions(m.Options)
+
+	// The type "bind" is a bind mount even without the option, as runc does.
+	if m.Type == "bind" {
+		options.flags |= unix.MS_BIND
+	}
+
+	bind := options.flags&unix.MS_BIND != 0
+
+	// A file can only be bind-mounted onto a file.
+	dir := true
+
+	if bind {
+		info, err := os.Stat(m.Source)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		dir = info.IsDir()
+	}
+
+	err := withMountPoint(rootfs, m.Destination, dir, func(path string) error {
+		if bind {
+			return unix.Mount(m.Source, path, "", options.flags&(unix.MS_BIND|unix.MS_REC), "")
+		}
+
+		return unix.Mount(m.Source, path, m.Type, options.flags, options.data)
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// mount(2) ignores the other flags on creating a bind mount, so they have to be applied by remounting.
+	flags := options.flags &^ (unix.MS_BIND | unix.MS_REC | unix.MS_REMOUNT)
+	remount := bind && flags != 0
+
+	if !remount && len(options.propagation) == 0 {
+		return nil
+	}
+
+	// The mount point opened before mounting still refers to the directory underneath, so it's opened again.
+	return withMountPoint(rootfs, m.Destination, dir, func(path string) error {
+		if remount {
+			if err := remountBind(path, flags); err != nil {
+				return err
+			}
+		}
+
+		for _, propagation := range options.propagation {
+			if err := unix.Mount("", path, "", propagation, ""); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// withMountPoint calls fn with a path to the mount point in rootfs, which is valid during the call.
+func withMountPoint(rootfs, destination string, dir bool, fn func(path string) error) error {
+	target, err := openMountPoint(rootfs, destination, dir)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	return fn(fmt.Sprintf("/proc/self/fd/%d", target.Fd()))
+}
+
+// openMountPoint opens the path in rootfs to be mounted on, creating a directory or an empty file there if it's missing.
+// Symbolic links are resolved within rootfs, so that an image can't make the runtime mount over a path of the host.
+func openMountPoint(rootfs, path string, dir bool) (*os.File, error) {
+	root, err := os.OpenFile(rootfs, unix.O_PATH|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer root.Close()
+
+	how := &unix.OpenHow{Flags: unix.O_PATH | unix.O_CLOEXEC, Resolve: unix.RESOLVE_IN_ROOT}
+
+	fd, err := unix.Openat2(int(root.Fd()), path, how)
+	if errors.Is(err, unix.ENOENT) {
+		if err := createMountPoint(rootfs, path, dir); err != nil {
+			return nil, err
+		}
+
+		fd, err = unix.Openat2(int(root.Fd()), path, how)
+	}
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+func createMountPoint(rootfs, path string, dir bool) error {
+	parent, err := openMountPoint(rootfs, filepath.Dir(path), true)
+	if err != nil {
+		return err
+	}
+	defer parent.Close()
+
+	name := filepath.Base(path)
+
+	if dir {
+		err = unix.Mkdirat(int(parent.Fd()), name, mountPointPermission)
+	} else {
+		err = unix.Mknodat(int(parent.Fd()), name, unix.S_IFREG|mountFilePermission, 0)
+	}
+
+	if err != nil && !errors.Is(err, unix.EEXIST) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// remountBind changes the flags of a bind mount.
+// The flags locked by the kernel, which a user namespace can't clear, are carried over from the current ones.
+func remountBind(path string, flags uintptr) error {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, locked := range []struct {
+		st    int64
+		flags uintptr
+	}{
+		{st: unix.ST_NOSUID, flags: unix.MS_NOSUID},
+		{st: unix.ST_NODEV, flags: unix.MS_NODEV},
+		{st: unix.ST_NOEXEC, flags: unix.MS_NOEXEC},
+		{st: unix.ST_RDONLY, flags: unix.MS_RDONLY},
+	} {
+		if int64(stat.Flags)&locked.st != 0 { //nolint:unconvert // int32 on 386
+			flags |= locked.flags
+		}
+	}
+
+	if err := unix.Mount("", path, "", unix.MS_BIND|unix.MS_REMOUNT|flags, ""); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// maskPaths hides the paths in the container, with an empty read-only tmpfs for a directory or /dev/null for a file.
+func maskPaths(paths []string) error {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if info.IsDir() {
+			err = unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY, "")
+		} else {
+			err = unix.Mount("/dev/null", path, "", unix.MS_BIND, "")
+		}
+
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// readonlyPaths makes the paths in the container read-only.
+func readonlyPaths(paths []string) error {
+	for _, path := range paths {
+		// Only a mount point can be remounted.
+		err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, "")
+		if errors.Is(err, unix.ENOENT) {
+			continue
+		}
+
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := remountBind(path, unix.MS_RDONLY); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mountFlags is the list of mounts added with --volume and --tmpfs, in the order given.
+type mountFlags []specMount
+
+func registerMountFlags(flags *flag.FlagSet) *mountFlags {
+	mounts := &mountFlags{}
+
+	flags.Func("volume", "bind mount in the form of HOST_PATH:CONTAINER_PATH[:OPTIONS], with comma-separated options like ro (repeatable)",
+		func(value string) error {
+			source, rest, ok := strings.Cut(value, ":")
+			if !ok {
+				return errors.WithStack(fmt.Errorf("%w: %q", ErrInvalidMount, value))
+			}
+
+			source, err := filepath.Abs(source)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			destination, options, _ := strings.Cut(rest, ":")
+
+			mount := specMount{Destination: destination, Type: "bind", Source: source, Options: []string{"rbind"}}
+			if options != "" {
+				mount.Options = append(mount.Options, strings.Split(options, ",")...)
+			}
+
+			*mounts = append(*mounts, mount)
+
+			return nil
+		})
+
+	flags.Func("tmpfs", "tmpfs mount in the form of CONTAINER_PATH[:OPTIONS], with comma-separated options like size=64m (repeatable)",
+		func(value string) error {
+			destination, options, _ := strings.Cut(value, ":")
+
+			mount := specMount{Destination: destination, Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "nodev"}}
+			if options != "" {
+				mount.Options = append(mount.Options, strings.Split(options, ",")...)
+			}
+
+			*mounts = append(*mounts, mount)
+
+			return nil
+		})
+
+	return mounts
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseMountOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options []string
+		want    mountOptions
+	}{
+		{name: "none", options: nil, want: mountOptions{}},
+		{name: "set flags", options: []string{"ro", "nosuid", "nodev"}, want: mountOptions{flags: unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV}},
+		{name: "rw after ro", options: []string{"ro", "rw"}, want: mountOptions{}},
+		{name: "ro after rw", options: []string{"rw", "ro"}, want: mountOptions{flags: unix.MS_RDONLY}},
+		{name: "clear leaves the others", options: []string{"noexec", "nosuid", "exec"}, want: mountOptions{flags: unix.MS_NOSUID}},
+		{name: "bind", options: []string{"bind"}, want: mountOptions{flags: unix.MS_BIND}},
+		{name: "rbind", options: []string{"rbind", "ro"}, want: mountOptions{flags: unix.MS_BIND | unix.MS_REC | unix.MS_RDONLY}},
+		{
+			name:    "propagation",
+			options: []string{"rprivate", "shared", "runbindable"},
+			want: mountOptions{propagation: []uintptr{
+				unix.MS_PRIVATE | unix.MS_REC, unix.MS_SHARED, unix.MS_UNBINDABLE | unix.MS_REC,
+			}},
+		},
+		{name: "defaults", options: []string{"defaults"}, want: mountOptions{}},
+		{name: "data", options: []string{"mode=755", "size=65536k"}, want: mountOptions{data: "mode=755,size=65536k"}},
+		{
+			name:    "mixed",
+			options: []string{"nosuid", "mode=1777", "defaults", "slave", "uid=0"},
+			want:    mountOptions{flags: unix.MS_NOSUID, propagation: []uintptr{unix.MS_SLAVE}, data: "mode=1777,uid=0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseMountOptions(tt.options)
+			if got.flags != tt.want.flags || !slices.Equal(got.propagation, tt.want.propagation) || got.data != tt.want.data {
+				t.Errorf("parseMountOptions(%q) = %+v, want %+v", tt.options, got, tt.want)
+			}
+		})
+	}
+}
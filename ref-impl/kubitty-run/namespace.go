@@ -0,0 +1,290 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+// nsGetNSType is NS_GET_NSTYPE of linux/nsfs.h, which golang.org/x/sys/unix lacks.
+const nsGetNSType = 0xb703
+
+var (
+	ErrUnknownNamespace      = errors.New("unknown namespace type")
+	ErrJoinUnsupported       = errors.New("user and time namespaces can't be joined by the runtime")
+	ErrNotNamespace          = errors.New("not a namespace file")
+	ErrNamespaceTypeMismatch = errors.New("namespace file of another type")
+	ErrInvalidNamespacePath  = errors.New(`invalid namespace path, expected "TYPE=PATH"`)
+	ErrPathUnsupported       = errors.New("only net, ipc and uts namespaces can be joined by path")
+)
+
+type namespaceType struct {
+	// name is the entry name under /proc/<pid>/ns.
+	name string
+	// ociType is the type name used in linux.namespaces of the OCI runtime spec.
+	ociType   string
+	flagName  string
+	cloneFlag uintptr
+	usage     string
+}
+
+func namespaceTypes() []namespaceType {
+	return []namespaceType{
+		{name: "uts", ociType: "uts", flagName: "uts", cloneFlag: unix.CLONE_NEWUTS, usage: "isolate hostname and domain name"},
+		{name: "pid", ociType: "pid", flagName: "pid", cloneFlag: unix.CLONE_NEWPID, usage: "isolate process IDs"},
+		{name: "mnt", ociType: "mount", flagName: "mount", cloneFlag: unix.CLONE_NEWNS, usage: "isolate mount points"},
+		{name: "ipc", ociType: "ipc", flagName: "ipc", cloneFlag: unix.CLONE_NEWIPC, usage: "isolate System V IPC and POSIX message queues"},
+		{name: "net", ociType: "network", flagName: "net", cloneFlag: unix.CLONE_NEWNET, usage: "isolate network devices, stacks and ports"},
+		{name: "user", ociType: "user", flagName: "user", cloneFlag: unix.CLONE_NEWUSER, usage: "isolate user and group IDs"},
+		{name: "cgroup", ociType: "cgroup", flagName: "cgroup", cloneFlag: unix.CLONE_NEWCGROUP, usage: "isolate the cgroup root directory"},
+		{name: "time", ociType: "time", flagName: "time", cloneFlag: unix.CLONE_NEWTIME, usage: "isolate boot and monotonic clocks"},
+	}
+}
+
+// sharable reports whether a container can join the namespace by path, which is the case for those shared in a pod.
+// The others would expose the host, like a mount namespace under the rootfs set up by the runtime.
+func (t namespaceType) sharable() bool {
+	switch t.cloneFlag {
+	case unix.CLONE_NEWNET, unix.CLONE_NEWIPC, unix.CLONE_NEWUTS:
+		return true
+	default:
+		return false
+	}
+}
+
+func lookupNamespaceType(ociType string) (namespaceType, error) {
+	for _, nsType := range namespaceTypes() {
+		if nsType.ociType == ociType {
+			return nsType, nil
+		}
+	}
+
+	return namespaceType{}, errors.WithStack(ErrUnknownNamespace)
+}
+
+// cloneFlags converts the namespaces of a spec into CLONE_NEW* flags. Namespaces with a path are joined instead.
+func cloneFlags(namespaces []specNamespace) (uintptr, error) {
+	var flags uintptr
+
+	for _, namespace := range namespaces {
+		nsType, err := lookupNamespaceType(namespace.Type)
+		if err != nil {
+			return 0, err
+		}
+
+		if namespace.Path == "" {
+			flags |= nsType.cloneFlag
+		}
+	}
+
+	return flags, nil
+}
+
+// hasNamespace reports whether the container has its own namespace of the type, either created or joined.
+func hasNamespace(namespaces []specNamespace, ociType string) bool {
+	for _, namespace := range namespaces {
+		if namespace.Type == ociType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// createsNamespace reports whether a new namespace of the type is created for the container.
+func createsNamespace(namespaces []specNamespace, ociType string) bool {
+	for _, namespace := range namespaces {
+		if namespace.Type == ociType && namespace.Path == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// openNamespaces opens the namespaces of the process, to be joined by joinNamespaces.
+func openNamespaces(pid int, namespaces []specNamespace) ([]*os.File, error) {
+	files := []*os.File{}
+
+	for _, namespace := range namespaces {
+		nsType, err := lookupNamespaceType(namespace.Type)
+		if err != nil {
+			closeFiles(files)
+
+			return nil, err
+		}
+
+		file, err := openNamespace(fmt.Sprintf("/proc/%d/ns/%s", pid, nsType.name), nsType)
+		if err != nil {
+			closeFiles(files)
+
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// openNamespacePaths opens the namespaces of a spec which have a path, to be joined by joinNamespaces.
+func openNamespacePaths(namespaces []specNamespace) ([]*os.File, error) {
+	files := []*os.File{}
+
+	for _, namespace := range namespaces {
+		if namespace.Path == "" {
+			continue
+		}
+
+		nsType, err := lookupNamespaceType(namespace.Type)
+		if err != nil {
+			closeFiles(files)
+
+			return nil, err
+		}
+
+		if !nsType.sharable() {
+			closeFiles(files)
+
+			return nil, errors.WithStack(fmt.Errorf("%w: %s", ErrPathUnsupported, namespace.Type))
+		}
+
+		file, err := openNamespace(namespace.Path, nsType)
+		if err != nil {
+			closeFiles(files)
+
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// openNamespace opens a file referring to a namespace, like /proc/<pid>/ns/net or a bind mount of it,
+// and checks that the namespace is of the type.
+func openNamespace(path string, nsType namespaceType) (*os.File, error) {
+	// A multi-threaded process can't join a user or time namespace, which Go programs always are.
+	if nsType.cloneFlag == unix.CLONE_NEWUSER || nsType.cloneFlag == unix.CLONE_NEWTIME {
+		return nil, errors.WithStack(ErrJoinUnsupported)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The ioctl fails with ENOTTY on files out of nsfs.
+	kind, err := unix.IoctlRetInt(int(file.Fd()), nsGetNSType)
+	if err != nil {
+		file.Close()
+
+		return nil, errors.WithStack(fmt.Errorf("%w: %s", ErrNotNamespace, path))
+	}
+
+	if uintptr(kind) != nsType.cloneFlag {
+		file.Close()
+
+		return nil, errors.WithStack(fmt.Errorf("%w: %s is not a %s namespace", ErrNamespaceTypeMismatch, path, nsType.ociType))
+	}
+
+	return file, nil
+}
+
+// joinNamespaces moves the current thread into the namespaces.
+// The thread must be locked and never be used by other goroutines afterwards.
+// Its new PID namespace only applies to the children.
+func joinNamespaces(files []*os.File) error {
+	// setns(2) into a mount namespace requires the thread not to share its root and working directory with others.
+	if err := unix.Unshare(unix.CLONE_FS); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, file := range files {
+		if err := unix.Setns(int(file.Fd()), 0); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
+
+// namespaceFlags holds the namespace selection of a command line, keyed by namespace name.
+type namespaceFlags struct {
+	enabled map[string]*bool
+	// paths are the namespaces to be joined instead of creating new ones.
+	paths map[string]string
+}
+
+func registerNamespaceFlags(flags *flag.FlagSet) *namespaceFlags {
+	nsFlags := &namespaceFlags{enabled: map[string]*bool{}, paths: map[string]string{}}
+
+	for _, nsType := range namespaceTypes() {
+		// UTS namespace is unshared by default to keep the behavior of the previous step.
+		nsFlags.enabled[nsType.name] = flags.Bool(nsType.flagName, nsType.name == "uts", nsType.usage)
+	}
+
+	flags.Func("ns", `net, ipc or uts namespace to join in the form of "TYPE=PATH" like "net=/proc/<pid>/ns/net" (repeatable)`, nsFlags.setPath)
+
+	return nsFlags
+}
+
+// setPath parses the value of --ns. TYPE is either the flag name or the OCI type of the namespace.
+func (n *namespaceFlags) setPath(value string) error {
+	typ, path, ok := strings.Cut(value, "=")
+	if !ok || path == "" {
+		return errors.WithStack(ErrInvalidNamespacePath)
+	}
+
+	for _, nsType := range namespaceTypes() {
+		if typ == nsType.flagName || typ == nsType.ociType {
+			if !nsType.sharable() {
+				return errors.WithStack(fmt.Errorf("%w: %s", ErrPathUnsupported, typ))
+			}
+
+			n.paths[nsType.name] = path
+
+			return nil
+		}
+	}
+
+	return errors.WithStack(fmt.Errorf("%w: %s", ErrUnknownNamespace, typ))
+}
+
+func (n *namespaceFlags) enable(name string) {
+	if enabled, ok := n.enabled[name]; ok {
+		*enabled = true
+	}
+}
+
+// joined reports whether the namespace is joined by --ns.
+func (n *namespaceFlags) joined(name string) bool {
+	_, ok := n.paths[name]
+
+	return ok
+}
+
+func (n *namespaceFlags) namespaces() []specNamespace {
+	namespaces := []specNamespace{}
+
+	for _, nsType := range namespaceTypes() {
+		if path, ok := n.paths[nsType.name]; ok {
+			namespaces = append(namespaces, specNamespace{Type: nsType.ociType, Path: path})
+		} else if enabled, ok := n.enabled[nsType.name]; ok && *enabled {
+			namespaces = append(namespaces, specNamespace{Type: nsType.ociType})
+		}
+	}
+
+	return namespaces
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunNamespaces(t *testing.T) {
+	t.Parallel()
+
+	if os.Geteuid() != 0 {
+		t.Skip("creating namespaces requires root")
+	}
+
+	names := []string{"cgroup", "ipc", "mnt", "net", "pid", "user", "uts"}
+	host := map[string]string{}
+
+	for _, name := range names {
+		link, err := os.Readlink("/proc/self/ns/" + name)
+		if err != nil {
+			t.Fatalf("os.Readlink() error = %v", err)
+		}
+
+		host[name] = link
+	}
+
+	tests := []struct {
+		name  string
+		flags []string
+		want  []string
+	}{
+		{name: "default", flags: nil, want: []string{"uts"}},
+		{name: "pid and net", flags: []string{"-pid", "-net"}, want: []string{"net", "pid", "uts"}},
+		{name: "ipc and cgroup without uts", flags: []string{"-ipc", "-cgroup", "-uts=false"}, want: []string{"cgroup", "ipc"}},
+		{name: "mount", flags: []string{"-mount"}, want: []string{"mnt", "uts"}},
+		{name: "init", flags: []string{"-init"}, want: []string{"pid", "uts"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Each link is "TYPE:[INODE]", the inode of which identifies the namespace.
+			args := append(append([]string{"run"}, tt.flags...), "readlink")
+			for _, name := range names {
+				args = append(args, "/proc/self/ns/"+name)
+			}
+
+			out, err := exec.CommandContext(t.Context(), "/proc/self/exe", args...).Output()
+			if err != nil {
+				t.Fatalf("run %v error = %v", tt.flags, err)
+			}
+
+			links := strings.Fields(string(out))
+			if len(links) != len(names) {
+				t.Fatalf("run %v printed %q, want a link for each of %v", tt.flags, out, names)
+			}
+
+			for i, name := range names {
+				if created := links[i] != host[name]; created != slices.Contains(tt.want, name) {
+					t.Errorf("run %v: %s namespace is %s, host has %s, want new %t", tt.flags, name, links[i], host[name], !created)
+				}
+			}
+		})
+	}
+}
+
+func TestNamespaceFlags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		args   []string
+		enable []string
+		want   []specNamespace
+	}{
+		{name: "default", args: nil, want: []specNamespace{{Type: "uts"}}},
+		{name: "none", args: []string{"-uts=false"}, want: []specNamespace{}},
+		{
+			name: "in the order of the types",
+			args: []string{"-net", "-mount", "-pid"},
+			want: []specNamespace{{Type: "uts"}, {Type: "pid"}, {Type: "mount"}, {Type: "network"}},
+		},
+		{name: "enabled by another flag", args: []string{"-uts=false"}, enable: []string{"mnt"}, want: []specNamespace{{Type: "mount"}}},
+		{
+			name: "joined by flag name",
+			args: []string{"-ns", "net=/run/netns/a"},
+			want: []specNamespace{{Type: "uts"}, {Type: "network", Path: "/run/netns/a"}},
+		},
+		{
+			name: "joined by OCI type",
+			args: []string{"-ns", "network=/run/netns/a"},
+			want: []specNamespace{{Type: "uts"}, {Type: "network", Path: "/run/netns/a"}},
+		},
+		{
+			name:   "joined over enabled",
+			args:   []string{"-net", "-ns", "uts=/run/uts", "-ns", "net=/run/netns/b"},
+			enable: []string{"net"},
+			want:   []specNamespace{{Type: "uts", Path: "/run/uts"}, {Type: "network", Path: "/run/netns/b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			nsFlags := registerNamespaceFlags(flags)
+
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.args, err)
+			}
+
+			for _, name := range tt.enable {
+				nsFlags.enable(name)
+			}
+
+			if got := nsFlags.namespaces(); !slices.Equal(got, tt.want) {
+				t.Errorf("namespaces() of %q = %+v, want %+v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceFlagsSetPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr error
+	}{
+		{name: "ipc", value: "ipc=/proc/1/ns/ipc"},
+		{name: "no path", value: "net", wantErr: ErrInvalidNamespacePath},
+		{name: "empty path", value: "net=", wantErr: ErrInvalidNamespacePath},
+		{name: "not sharable", value: "pid=/proc/1/ns/pid", wantErr: ErrPathUnsupported},
+		{name: "user", value: "user=/proc/1/ns/user", wantErr: ErrPathUnsupported},
+		{name: "unknown", value: "foo=/proc/1/ns/foo", wantErr: ErrUnknownNamespace},
+		{name: "name of the entry", value: "mnt=/proc/1/ns/mnt", wantErr: ErrUnknownNamespace},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			nsFlags := registerNamespaceFlags(flags)
+
+			err := nsFlags.setPath(tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("setPath(%q) error = %v, want %v", tt.value, err, tt.wantErr)
+			}
+
+			// A rejected namespace is left to be created or shared with the host.
+			if joined := slices.ContainsFunc(nsFlags.namespaces(), func(namespace specNamespace) bool {
+				return namespace.Path != ""
+			}); joined != (tt.wantErr == nil) {
+				t.Errorf("namespaces() after setPath(%q) = %+v", tt.value, nsFlags.namespaces())
+			}
+		})
+	}
+}
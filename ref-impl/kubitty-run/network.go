@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+
+	"github.com/k1LoW/errors"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/netlink"
+)
+
+const (
+	loopbackName = "lo"
+	// containerLinkName is the name of the container side of the veth pair.
+	containerLinkName = "eth0"
+)
+
+var (
+	ErrInvalidNetwork     = errors.New("--address and --gateway must be given together, with the gateway in the network of the address")
+	ErrNetworkWithoutRoot = errors.New("a veth pair can only be created by root")
+	ErrNetworkJoined      = errors.New("--address can't be used with a joined network namespace")
+)
+
+// networkConfig connects the network namespace of a container to the host with a veth pair.
+type networkConfig struct {
+	// Address is the address of the container side. The host side is in the same network.
+	Address netip.Prefix `json:"address"`
+	// Gateway is the address of the host side, which is also the default gateway of the container.
+	Gateway netip.Addr `json:"gateway"`
+}
+
+// networkFlags holds --address and --gateway of a command line.
+type networkFlags struct {
+	address *string
+	gateway *string
+}
+
+func registerNetworkFlags(flags *flag.FlagSet) *networkFlags {
+	return &networkFlags{
+		address: flags.String("address", "", "address of the container in CIDR notation, connected to the host with a veth pair"),
+		gateway: flags.String("gateway", "", "address of the host side of the veth pair, used as the default gateway"),
+	}
+}
+
+// network converts the flags into the config, returning nil if they are not given.
+func (n *networkFlags) network() (*networkConfig, error) {
+	if *n.address == "" && *n.gateway == "" {
+		return nil, nil //nolint:nilnil // no network is a valid result
+	}
+
+	address, err := netip.ParsePrefix(*n.address)
+	if err != nil {
+		return nil, errors.WithStack(ErrInvalidNetwork)
+	}
+
+	gateway, err := netip.ParseAddr(*n.gateway)
+	if err != nil || !address.Masked().Contains(gateway) || gateway == address.Addr() {
+		return nil, errors.WithStack(ErrInvalidNetwork)
+	}
+
+	if rootless() {
+		return nil, errors.WithStack(ErrNetworkWithoutRoot)
+	}
+
+	return &networkConfig{Address: address, Gateway: gateway}, nil
+}
+
+// createVeth creates a veth pair whose container side is put into the network namespace of pid,
+// and sets up the host side. The pair is deleted with the namespace.
+func createVeth(pid int, network *networkConfig) error {
+	ns, err := os.Open(fmt.Sprintf("/proc/%d/ns/net", pid))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer ns.Close()
+
+	conn, err := netlink.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Interface names are limited to 15 bytes, which the pid always fits in.
+	hostName := fmt.Sprintf("kubitty%d", pid)
+
+	if err := conn.AddVeth(netlink.Veth{Name: hostName, PeerName: containerLinkName, PeerNamespace: ns}); err != nil {
+		return err
+	}
+
+	link, err := conn.LinkByName(hostName)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.AddAddress(link.Index, netip.PrefixFrom(network.Gateway, network.Address.Bits())); err != nil {
+		return err
+	}
+
+	return conn.SetLinkUp(link.Index)
+}
+
+// setupNetwork brings up the loopback of a new network namespace, and the container side of the veth pair if any.
+func setupNetwork(network *networkConfig) error {
+	conn, err := netlink.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	loopback, err := conn.LinkByName(loopbackName)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.SetLinkUp(loopback.Index); err != nil {
+		return err
+	}
+
+	if network == nil {
+		return nil
+	}
+
+	link, err := conn.LinkByName(containerLinkName)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.AddAddress(link.Index, network.Address); err != nil {
+		return err
+	}
+
+	if err := conn.SetLinkUp(link.Index); err != nil {
+		return err
+	}
+
+	return conn.AddRoute(netlink.Route{Gateway: network.Gateway, LinkIndex: link.Index})
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// namespaceDirName is the directory under the state root holding the persistent namespaces, like /run/netns of ip-netns(8).
+	namespaceDirName = "netns"
+
+	namespaceFilePermission = 0o444
+)
+
+var (
+	ErrInvalidNamespaceCommand = errors.New(`namespace command must be "create" or "delete"`)
+	ErrInvalidNamespaceName    = errors.New("invalid namespace name")
+	ErrNamespaceExists         = errors.New("namespace already exists")
+	ErrNamespaceMissing        = errors.New("namespace does not exist")
+)
+
+// persistentNamespaceTypes returns the namespaces "kubitty-run ns" can create, which are the ones shared in a pod.
+func persistentNamespaceTypes() []namespaceType {
+	types := []namespaceType{}
+
+	for _, nsType := range namespaceTypes() {
+		if nsType.sharable() {
+			types = append(types, nsType)
+		}
+	}
+
+	return types
+}
+
+// namespaceCommand dispatches "kubitty-run ns create|delete".
+func namespaceCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.WithStack(ErrInvalidNamespaceCommand)
+	}
+
+	switch args[0] {
+	case "create":
+		return createNamespaceFiles(args[1:])
+	case "delete":
+		return deleteNamespaceFiles(args[1:])
+	default:
+		return errors.WithStack(fmt.Errorf("%w: %s", ErrInvalidNamespaceCommand, args[0]))
+	}
+}
+
+func namespaceRoot() string {
+	return filepath.Join(stateRoot(), namespaceDirName)
+}
+
+// namespaceDir returns the directory holding the namespace files of the name, like /run/kubitty/netns/<name>/net.
+func namespaceDir(name string) (string, error) {
+	if validateID(name) != nil {
+		return "", errors.WithStack(fmt.Errorf("%w: %s", ErrInvalidNamespaceName, name))
+	}
+
+	return filepath.Join(namespaceRoot(), name), nil
+}
+
+// createNamespaceFiles creates new namespaces and bind-mounts them onto files, which keep them alive without any process.
+func createNamespaceFiles(args []string) error {
+	flags := flag.NewFlagSet("ns create", flag.ContinueOnError)
+	selected := map[string]*bool{}
+
+	for _, nsType := range persistentNamespaceTypes() {
+		selected[nsType.name] = flags.Bool(nsType.flagName, false, "create a "+nsType.flagName+" namespace, all of which are created if none is given")
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	types := []namespaceType{}
+
+	for _, nsType := range persistentNamespaceTypes() {
+		if *selected[nsType.name] {
+			types = append(types, nsType)
+		}
+	}
+
+	if len(types) == 0 {
+		types = persistentNamespaceTypes()
+	}
+
+	dir, err := namespaceDir(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if err := prepareNamespaceRoot(); err != nil {
+		return err
+	}
+
+	if err := os.Mkdir(dir, stateDirPermission); err != nil {
+		if os.IsExist(err) {
+			return errors.WithStack(ErrNamespaceExists)
+		}
+
+		return errors.WithStack(err)
+	}
+
+	if err := bindNewNamespaces(dir, types); err != nil {
+		_ = removeNamespaceFiles(dir)
+
+		return err
+	}
+
+	return nil
+}
+
+// prepareNamespaceRoot makes the namespace root a shared mount as ip-netns(8) does,
+// so that the namespace files mounted later also appear in the mount namespaces copied from the host before.
+func prepareNamespaceRoot() error {
+	root := namespaceRoot()
+
+	if err := os.MkdirAll(root, stateDirPermission); err != nil {
+		return errors.WithStack(err)
+	}
+
+	err := unix.Mount("", root, "", unix.MS_SHARED|unix.MS_REC, "")
+	if err == nil {
+		return nil
+	}
+
+	// EINVAL means the directory is not a mount point yet.
+	if !errors.Is(err, unix.EINVAL) {
+		return errors.WithStack(err)
+	}
+
+	if err := unix.Mount(root, root, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := unix.Mount("", root, "", unix.MS_SHARED|unix.MS_REC, ""); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// bindNewNamespaces creates new namespaces of the types, and bind-mounts them under dir.
+// A dedicated thread moves into the namespaces, while the caller stays in those of the host.
+// The thread is never unlocked, so that Go runtime terminates it instead of reusing it.
+func bindNewNamespaces(dir string, types []namespaceType) error {
+	result := make(chan error, 1)
+
+	go func() {
+		runtime.LockOSThread()
+
+		result <- bindThreadNamespaces(dir, types)
+	}()
+
+	return <-result
+}
+
+// bindThreadNamespaces moves the current thread into new namespaces of the types, and bind-mounts them under dir.
+func bindThreadNamespaces(dir string, types []namespaceType) error {
+	var flags uintptr
+	for _, nsType := range types {
+		flags |= nsType.cloneFlag
+	}
+
+	if err := unix.Unshare(int(flags)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The loopback of a new network namespace is down, and containers joining it don't set it up.
+	if flags&unix.CLONE_NEWNET != 0 {
+		if err := setupNetwork(nil); err != nil {
+			return err
+		}
+	}
+
+	for _, nsType := range types {
+		path := filepath.Join(dir, nsType.name)
+
+		// A bind mount needs an existing file as its target.
+		file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE|os.O_EXCL, namespaceFilePermission)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		file.Close()
+
+		// /proc/self would refer to the namespaces of the main thread, which are left untouched.
+		if err := unix.Mount("/proc/thread-self/ns/"+nsType.name, path, "", unix.MS_BIND, ""); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// deleteNamespaceFiles unmounts the namespace files, which lets the namespaces go once no process is in them.
+func deleteNamespaceFiles(args []string) error {
+	flags := flag.NewFlagSet("ns delete", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	dir, err := namespaceDir(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return errors.WithStack(ErrNamespaceMissing)
+		}
+
+		return errors.WithStack(err)
+	}
+
+	return removeNamespaceFiles(dir)
+}
+
+func removeNamespaceFiles(dir string) error {
+	for _, nsType := range persistentNamespaceTypes() {
+		path := filepath.Join(dir, nsType.name)
+
+		// The file may be left unmounted by a failure of creation.
+		if err := unix.Unmount(path, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) && !errors.Is(err, unix.ENOENT) {
+			return errors.WithStack(err)
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := os.Remove(dir); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	freezePollInterval = 10 * time.Millisecond
+	freezeTimeout      = 5 * time.Second
+)
+
+var ErrFreezeTimeout = errors.New("timed out waiting for the cgroup to be frozen or thawed")
+
+// pause freezes all processes of a running container.
+func pause(args []string) error {
+	flags := flag.NewFlagSet("pause", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return transitFreezer(flags.Arg(0), statusRunning, statusPaused)
+}
+
+// resume thaws all processes of a paused container.
+func resume(args []string) error {
+	flags := flag.NewFlagSet("resume", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return transitFreezer(flags.Arg(0), statusPaused, statusRunning)
+}
+
+// transitFreezer freezes or thaws the cgroup of a container in the from status, and records the to status.
+func transitFreezer(id string, from, to containerStatus) error {
+	return withContainer(id, unix.LOCK_EX, func(state *containerState) error {
+		if state.Status != from {
+			return errors.WithStack(ErrInvalidStatus)
+		}
+
+		cg := containerCgroup(state)
+		if cg == nil {
+			return errors.WithStack(ErrNoCgroup)
+		}
+
+		if err := cg.freeze(to == statusPaused); err != nil {
+			return err
+		}
+
+		state.Status = to
+
+		return saveState(state)
+	})
+}
+
+// freeze freezes or thaws the cgroup, and waits until all of its processes have stopped or resumed.
+// The cgroup is rolled back on timeout, so that it's never left half frozen.
+func (c *cgroup) freeze(frozen bool) error {
+	value := "0"
+	if frozen {
+		value = "1"
+	}
+
+	if err := c.writeFile("cgroup.freeze", value); err != nil {
+		return err
+	}
+
+	// Writing cgroup.freeze only starts the transition, which completes once cgroup.events reports it.
+	for deadline := time.Now().Add(freezeTimeout); time.Now().Before(deadline); time.Sleep(freezePollInterval) {
+		values, err := c.readKeyedFile("cgroup.events")
+		if err != nil {
+			return err
+		}
+
+		if (values["frozen"] != 0) == frozen {
+			return nil
+		}
+	}
+
+	if frozen {
+		_ = c.writeFile("cgroup.freeze", "0")
+	}
+
+	return errors.WithStack(ErrFreezeTimeout)
+}
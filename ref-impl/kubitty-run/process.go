@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+// signalExitCodeBase is added to the signal number when the process is killed by a signal, as shells do.
+const signalExitCodeBase = 128
+
+var ErrInvalidProcStat = errors.New("invalid format of /proc/<pid>/stat")
+
+type initProcess struct {
+	cmd *exec.Cmd
+	// sync is the runtime side of the socket pair shared with the init process.
+	sync *os.File
+	// console is the master of the pseudo terminal, if the process has a terminal.
+	console *os.File
+	// network is connected to the network namespace of the process before createContainer hooks.
+	network *networkConfig
+}
+
+// initOptions are the runtime side settings of the init process, which are not sent to it.
+type initOptions struct {
+	// extraFiles are passed to the init process from fd 4.
+	extraFiles []*os.File
+	// cgroup is the cgroup the init process is placed into. nil means the cgroup of the runtime.
+	cgroup *cgroup
+	// namespaces are joined by the init process instead of creating new ones.
+	namespaces []*os.File
+	// stdio replaces the standard streams of the runtime given to the init process.
+	stdio *stdio
+}
+
+// stdio is the standard streams of a process.
+type stdio struct {
+	stdin  *os.File
+	stdout *os.File
+	stderr *os.File
+}
+
+// startInit re-executes the runtime itself as the init process in the new namespaces and sends config to it.
+func startInit(config *containerConfig, opts initOptions) (*initProcess, error) {
+	var flags uintptr
+
+	if !config.Exec {
+		var err error
+
+		if flags, err = cloneFlags(config.Spec.Linux.Namespaces); err != nil {
+			return nil, err
+		}
+
+		// The namespaces with a path are joined in the same way as exec, and the others are created on clone.
+		joined, err := openNamespacePaths(config.Spec.Linux.Namespaces)
+		if err != nil {
+			return nil, err
+		}
+		defer closeFiles(joined)
+
+		opts.namespaces = append(opts.namespaces, joined...)
+	}
+
+	// SOCK_SEQPACKET keeps the boundaries of messages, some of which carry a file descriptor.
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	parent := os.NewFile(uintptr(fds[0]), "init-sync-parent")
+	child := os.NewFile(uintptr(fds[1]), "init-sync-child")
+
+	defer child.Close()
+
+	cmd, err := startInitCommand(flags, child, opts)
+	if err != nil {
+		parent.Close()
+
+		return nil, err
+	}
+
+	process := &initProcess{cmd: cmd, sync: parent, network: config.Network}
+
+	// The init process waits for the config, so its IDs are mapped before it starts setting up.
+	if flags&unix.CLONE_NEWUSER != 0 {
+		if err := writeIDMappings(process.pid(), config.Spec.Linux); err != nil {
+			process.kill()
+
+			return nil, err
+		}
+	}
+
+	if err := sendConfig(parent, config); err != nil {
+		process.kill()
+
+		return nil, err
+	}
+
+	return process, nil
+}
+
+// startInitCommand starts "kubitty-run init" with the namespaces of flags, passing it the child side of the sync socket.
+func startInitCommand(flags uintptr, child *os.File, opts initOptions) (*exec.Cmd, error) {
+	cmd := exec.Command("/proc/self/exe", "init")
+
+	streams := opts.stdio
+	if streams == nil {
+		streams = &stdio{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	}
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = streams.stdin, streams.stdout, streams.stderr
+	cmd.ExtraFiles = append([]*os.File{child}, opts.extraFiles...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		// clone(2) can't create a time namespace, but unshare(2) followed by execve(2) moves the process into it.
+		Cloneflags:   flags &^ unix.CLONE_NEWTIME,
+		Unshareflags: flags & unix.CLONE_NEWTIME,
+	}
+
+	if flags&unix.CLONE_NEWUSER != 0 {
+		var err error
+
+		// The IDs are not mapped yet when the init process is executed, so it would lose every capability
+		// in the user namespace. Ambient capabilities survive execve(2) until the mappings are written.
+		if cmd.SysProcAttr.AmbientCaps, err = allCapabilities(); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.cgroup != nil {
+		// Placing the process at clone time makes the cgroup namespace rooted at the container's cgroup.
+		dir, err := opts.cgroup.open()
+		if err != nil {
+			return nil, err
+		}
+		defer dir.Close()
+
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	}
+
+	if err := startInNamespaces(cmd, opts.namespaces); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+// startInNamespaces starts cmd in the namespaces, while the caller stays in the namespaces of the host.
+// The child inherits the namespaces of the thread that forks it, so a dedicated thread joins them.
+// The thread is never unlocked, so that Go runtime terminates it instead of reusing it.
+func startInNamespaces(cmd *exec.Cmd, namespaces []*os.File) error {
+	if len(namespaces) == 0 {
+		return errors.WithStack(cmd.Start())
+	}
+
+	result := make(chan error, 1)
+
+	go func() {
+		runtime.LockOSThread()
+
+		if err := joinNamespaces(namespaces); err != nil {
+			result <- err
+
+			return
+		}
+
+		result <- errors.WithStack(cmd.Start())
+	}()
+
+	return <-result
+}
+
+func (p *initProcess) pid() int {
+	return p.cmd.Process.Pid
+}
+
+// waitReady blocks until the init process finishes setting up the container, and releases the sync socket.
+// state is passed to the hooks of the container. nil means the process isn't the init process of a container.
+func (p *initProcess) waitReady(hooks *specHooks, state *containerState) error {
+	defer p.sync.Close()
+
+	for {
+		message := syncMessage{}
+
+		file, err := receiveMessage(p.sync, &message)
+		if err != nil {
+			// The init process reports its failures, so it has crashed or been killed.
+			return errors.WithStack(ErrInitNotReady)
+		}
+
+		switch message.Type {
+		case syncTypeConsole:
+			p.console = file
+		case syncTypeCreateRuntime:
+			if err := p.createRuntime(hooks, state); err != nil {
+				return err
+			}
+		case syncTypeReady:
+			return nil
+		case syncTypeError:
+			return errors.WithStack(fmt.Errorf("%w: %s", ErrInitFailed, message.Error))
+		}
+	}
+}
+
+// createRuntime creates the veth pair and runs createRuntime hooks, and lets the init process continue with createContainer hooks.
+func (p *initProcess) createRuntime(hooks *specHooks, state *containerState) error {
+	if p.network != nil {
+		if err := createVeth(p.pid(), p.network); err != nil {
+			return err
+		}
+	}
+
+	var hookState *containerState
+
+	if hooks != nil && state != nil {
+		copied := *state
+		hookState = &copied
+		hookState.Status = statusCreating
+		hookState.Pid = p.pid()
+
+		if err := runHooks(hooks.CreateRuntime, hookState); err != nil {
+			return err
+		}
+	}
+
+	return sendMessage(p.sync, syncMessage{Type: syncTypeCreateContainer, State: hookState}, nil)
+}
+
+func (p *initProcess) kill() {
+	p.sync.Close()
+
+	if p.console != nil {
+		p.console.Close()
+	}
+
+	_ = p.cmd.Process.Kill()
+	_ = p.cmd.Wait()
+}
+
+// wait waits for the process and converts its termination into an exit code.
+func (p *initProcess) wait() (int, error) {
+	err := p.cmd.Wait()
+	if err == nil {
+		return 0, nil
+	}
+
+	exitErr, ok := errors.AsType[*exec.ExitError](err)
+	if !ok {
+		return 0, errors.WithStack(err)
+	}
+
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return signalExitCodeBase + int(status.Signal()), nil
+	}
+
+	return exitErr.ExitCode(), nil
+}
+
+// Indexes of the fields of /proc/<pid>/stat, counted from the state field.
+const (
+	procStatPPIDIndex      = 1
+	procStatStartTimeIndex = 19
+)
+
+type procStat struct {
+	state string
+	ppid  int
+	// startTime is the time the process started after system boot, in clock ticks.
+	startTime uint64
+}
+
+func readProcStat(pid int) (*procStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The state field follows the command name in parentheses, which may contain spaces.
+	fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+	if len(fields) <= procStatStartTimeIndex {
+		return nil, errors.WithStack(ErrInvalidProcStat)
+	}
+
+	ppid, err := strconv.Atoi(fields[procStatPPIDIndex])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	startTime, err := strconv.ParseUint(fields[procStatStartTimeIndex], 10, 64)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &procStat{state: fields[0], ppid: ppid, startTime: startTime}, nil
+}
+
+// processRunning reports whether pid still refers to the same process started at startTime, and it's not a zombie.
+// Comparing the start time prevents mistaking a process that reused the pid for the container.
+func processRunning(pid int, startTime uint64) bool {
+	stat, err := readProcStat(pid)
+	if err != nil {
+		return false
+	}
+
+	return stat.startTime == startTime && stat.state != "Z"
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/k1LoW/errors"
+)
+
+// containerProcess is a process in the cgroup of a container, as printed by ps.
+type containerProcess struct {
+	Pid     int    `json:"pid"`
+	PPid    int    `json:"ppid"`
+	State   string `json:"state"`
+	Command string `json:"command"`
+}
+
+// ps prints the processes in the cgroup of a container. Pids are those seen from the runtime, not the container.
+func ps(args []string) error {
+	flags := flag.NewFlagSet("ps", flag.ContinueOnError)
+	format := flags.String("format", "table", `output format, "table" or "json"`)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	cg, err := lookupCgroup(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	pids, err := cg.processes()
+	if err != nil {
+		return err
+	}
+
+	processes := []containerProcess{}
+
+	for _, pid := range pids {
+		process, err := readContainerProcess(pid)
+		// Skip processes exited meanwhile.
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		processes = append(processes, *process)
+	}
+
+	switch *format {
+	case "table":
+		return printProcessTable(processes)
+	case "json":
+		if err := json.NewEncoder(os.Stdout).Encode(processes); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	default:
+		return errors.WithStack(ErrUnknownFormat)
+	}
+}
+
+func readContainerProcess(pid int) (*containerProcess, error) {
+	stat, err := readProcStat(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	command := string(bytes.ReplaceAll(bytes.TrimRight(cmdline, "\x00"), []byte{0}, []byte{' '}))
+
+	// Zombies have no command line, so show their name in brackets as ps(1) does.
+	if command == "" {
+		comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		command = "[" + string(bytes.TrimSpace(comm)) + "]"
+	}
+
+	return &containerProcess{Pid: pid, PPid: stat.ppid, State: stat.state, Command: command}, nil
+}
+
+func printProcessTable(processes []containerProcess) error {
+	const padding = 3
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', 0)
+
+	fmt.Fprintln(writer, "PID\tPPID\tSTAT\tCMD")
+
+	for _, process := range processes {
+		fmt.Fprintf(writer, "%d\t%d\t%s\t%s\n", process.Pid, process.PPid, process.State, process.Command)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+// signalBufferSize is the number of signals queued while forwarding, since signal.Notify drops the ones not fitting in.
+const signalBufferSize = 32
+
+// superviseCommand runs the command as a child of the init process, which stays as PID 1 of the container like tini.
+// PID 1 has no default signal handlers and inherits every orphan, so it forwards signals to the command,
+// reaps the orphans and exits with the status of the command.
+func superviseCommand(path string, args, env []string) error {
+	// Orphans are reparented to the init process even when it's not PID 1, because the container shares the pid namespace.
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Start catching signals before forking, so that no SIGCHLD is missed.
+	signals := make(chan os.Signal, signalBufferSize)
+	signal.Notify(signals)
+
+	pid, err := syscall.ForkExec(path, args, &syscall.ProcAttr{
+		Env:   env,
+		Files: []uintptr{uintptr(unix.Stdin), uintptr(unix.Stdout), uintptr(unix.Stderr)},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for sig := range signals {
+		switch sig {
+		case unix.SIGCHLD:
+			status, exited, err := reapChildren(pid)
+			if err != nil {
+				return err
+			}
+
+			if exited {
+				return exitStatusError(status)
+			}
+		case unix.SIGURG:
+			// Go runtime uses SIGURG to preempt goroutines, which the command knows nothing about.
+		default:
+			if sig, ok := sig.(unix.Signal); ok {
+				if err := unix.Kill(pid, sig); err != nil && !errors.Is(err, unix.ESRCH) {
+					return errors.WithStack(err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// reapChildren waits for every child which has exited, and reports the status of the command if it's among them.
+func reapChildren(command int) (unix.WaitStatus, bool, error) {
+	var (
+		commandStatus unix.WaitStatus
+		exited        bool
+	)
+
+	for {
+		var status unix.WaitStatus
+
+		pid, err := unix.Wait4(-1, &status, unix.WNOHANG, nil)
+		if errors.Is(err, unix.ECHILD) || (err == nil && pid == 0) {
+			return commandStatus, exited, nil
+		}
+
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+
+		if err != nil {
+			return 0, false, errors.WithStack(err)
+		}
+
+		if pid == command {
+			commandStatus, exited = status, true
+		}
+	}
+}
+
+// exitStatusError converts the status of the command into the exit code of the init process, as a shell does.
+func exitStatusError(status unix.WaitStatus) error {
+	code := status.ExitStatus()
+	if status.Signaled() {
+		code = signalExitCodeBase + int(status.Signal())
+	}
+
+	if code == 0 {
+		return nil
+	}
+
+	return &exitCodeError{code: code}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+
+	"github.com/k1LoW/errors"
+)
+
+const throttleDeviceFields = 3
+
+var ErrInvalidThrottleDevice = errors.New(`throttle device must be in the form of "MAJOR:MINOR:RATE"`)
+
+// resourceFlags holds the resource limits given on a command line.
+// Zero values mean the limit is not specified.
+type resourceFlags struct {
+	memory     *int64
+	memorySwap *int64
+	cpuShares  *uint64
+	cpuQuota   *int64
+	cpuPeriod  *uint64
+	pidsLimit  *int64
+	blockIO    specBlockIO
+}
+
+func registerResourceFlags(flags *flag.FlagSet) *resourceFlags {
+	resFlags := &resourceFlags{
+		memory:     flags.Int64("memory", 0, "memory limit in bytes"),
+		memorySwap: flags.Int64("memory-swap", 0, "memory plus swap limit in bytes, -1 for unlimited swap"),
+		cpuShares:  flags.Uint64("cpu-shares", 0, "relative CPU weight, converted into cpu.weight"),
+		cpuQuota:   flags.Int64("cpu-quota", 0, "CPU time in microseconds the container can use in a period"),
+		cpuPeriod:  flags.Uint64("cpu-period", 0, "CPU period in microseconds"),
+		pidsLimit:  flags.Int64("pids-limit", 0, "maximum number of processes"),
+	}
+
+	throttles := []struct {
+		name    string
+		usage   string
+		devices *[]specThrottleDevice
+	}{
+		{name: "device-read-bps", usage: "read bytes per second of a device", devices: &resFlags.blockIO.ThrottleReadBpsDevice},
+		{name: "device-write-bps", usage: "write bytes per second of a device", devices: &resFlags.blockIO.ThrottleWriteBpsDevice},
+		{name: "device-read-iops", usage: "read IO per second of a device", devices: &resFlags.blockIO.ThrottleReadIOPSDevice},
+		{name: "device-write-iops", usage: "write IO per second of a device", devices: &resFlags.blockIO.ThrottleWriteIOPSDevice},
+	}
+
+	for _, throttle := range throttles {
+		flags.Func(throttle.name, "limit "+throttle.usage+` in the form of "MAJOR:MINOR:RATE" (repeatable)`, func(value string) error {
+			device, err := parseThrottleDevice(value)
+			if err != nil {
+				return err
+			}
+
+			*throttle.devices = append(*throttle.devices, device)
+
+			return nil
+		})
+	}
+
+	return resFlags
+}
+
+// resources converts the flags into OCI resources, returning nil if nothing is specified.
+func (r *resourceFlags) resources() *specResources {
+	resources := &specResources{}
+	specified := false
+
+	if *r.memory != 0 || *r.memorySwap != 0 {
+		resources.Memory = &specMemory{Limit: nonZero(*r.memory), Swap: nonZero(*r.memorySwap)}
+		specified = true
+	}
+
+	if *r.cpuShares != 0 || *r.cpuQuota != 0 || *r.cpuPeriod != 0 {
+		resources.CPU = &specCPU{Shares: nonZero(*r.cpuShares), Quota: nonZero(*r.cpuQuota), Period: nonZero(*r.cpuPeriod)}
+		specified = true
+	}
+
+	if *r.pidsLimit != 0 {
+		resources.Pids = &specPids{Limit: *r.pidsLimit}
+		specified = true
+	}
+
+	if len(r.blockIO.ThrottleReadBpsDevice)+len(r.blockIO.ThrottleWriteBpsDevice)+
+		len(r.blockIO.ThrottleReadIOPSDevice)+len(r.blockIO.ThrottleWriteIOPSDevice) > 0 {
+		resources.BlockIO = &r.blockIO
+		specified = true
+	}
+
+	if !specified {
+		return nil
+	}
+
+	return resources
+}
+
+func parseThrottleDevice(value string) (specThrottleDevice, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) != throttleDeviceFields {
+		return specThrottleDevice{}, errors.WithStack(ErrInvalidThrottleDevice)
+	}
+
+	major, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return specThrottleDevice{}, errors.WithStack(err)
+	}
+
+	minor, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return specThrottleDevice{}, errors.WithStack(err)
+	}
+
+	rate, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return specThrottleDevice{}, errors.WithStack(err)
+	}
+
+	return specThrottleDevice{Major: major, Minor: minor, Rate: rate}, nil
+}
+
+func nonZero[T int64 | uint64](value T) *T {
+	if value == 0 {
+		return nil
+	}
+
+	return &value
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Range of oom_score_adj, where the minimum disables the OOM killer for the process.
+const (
+	minOOMScoreAdj = -1000
+	maxOOMScoreAdj = 1000
+)
+
+var (
+	ErrUnknownRlimit      = errors.New("unknown rlimit")
+	ErrInvalidUlimit      = errors.New(`ulimit must be in the form of "NAME=SOFT[:HARD]"`)
+	ErrInvalidOOMScoreAdj = errors.New("oom_score_adj must be between -1000 and 1000")
+)
+
+func rlimitNumbers() map[string]int {
+	return map[string]int{
+		"RLIMIT_AS":         unix.RLIMIT_AS,
+		"RLIMIT_CORE":       unix.RLIMIT_CORE,
+		"RLIMIT_CPU":        unix.RLIMIT_CPU,
+		"RLIMIT_DATA":       unix.RLIMIT_DATA,
+		"RLIMIT_FSIZE":      unix.RLIMIT_FSIZE,
+		"RLIMIT_LOCKS":      unix.RLIMIT_LOCKS,
+		"RLIMIT_MEMLOCK":    unix.RLIMIT_MEMLOCK,
+		"RLIMIT_MSGQUEUE":   unix.RLIMIT_MSGQUEUE,
+		"RLIMIT_NICE":       unix.RLIMIT_NICE,
+		"RLIMIT_NOFILE":     unix.RLIMIT_NOFILE,
+		"RLIMIT_NPROC":      unix.RLIMIT_NPROC,
+		"RLIMIT_RSS":        unix.RLIMIT_RSS,
+		"RLIMIT_RTPRIO":     unix.RLIMIT_RTPRIO,
+		"RLIMIT_RTTIME":     unix.RLIMIT_RTTIME,
+		"RLIMIT_SIGPENDING": unix.RLIMIT_SIGPENDING,
+		"RLIMIT_STACK":      unix.RLIMIT_STACK,
+	}
+}
+
+// registerUlimitFlags registers --ulimit, whose values are appended to rlimits.
+func registerUlimitFlags(flags *flag.FlagSet) *[]specRlimit {
+	rlimits := &[]specRlimit{}
+
+	flags.Func("ulimit", `resource limit in the form of "NAME=SOFT[:HARD]" like "nofile=1024:2048", -1 for unlimited (repeatable)`,
+		func(value string) error {
+			rlimit, err := parseUlimit(value)
+			if err != nil {
+				return err
+			}
+
+			*rlimits = append(*rlimits, rlimit)
+
+			return nil
+		})
+
+	return rlimits
+}
+
+// parseUlimit parses a ulimit in the format of Docker. The hard limit defaults to the soft limit.
+func parseUlimit(value string) (specRlimit, error) {
+	name, limits, ok := strings.Cut(value, "=")
+	if !ok {
+		return specRlimit{}, errors.WithStack(ErrInvalidUlimit)
+	}
+
+	rlimit := specRlimit{Type: "RLIMIT_" + strings.ToUpper(name)}
+	if _, ok := rlimitNumbers()[rlimit.Type]; !ok {
+		return specRlimit{}, errors.WithStack(ErrUnknownRlimit)
+	}
+
+	soft, hard, hasHard := strings.Cut(limits, ":")
+
+	var err error
+
+	if rlimit.Soft, err = parseRlimitValue(soft); err != nil {
+		return specRlimit{}, err
+	}
+
+	rlimit.Hard = rlimit.Soft
+
+	if hasHard {
+		if rlimit.Hard, err = parseRlimitValue(hard); err != nil {
+			return specRlimit{}, err
+		}
+	}
+
+	return rlimit, nil
+}
+
+func parseRlimitValue(value string) (uint64, error) {
+	if value == "-1" {
+		return unix.RLIM_INFINITY, nil
+	}
+
+	limit, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, errors.WithStack(ErrInvalidUlimit)
+	}
+
+	return limit, nil
+}
+
+// setRlimits applies the resource limits of the process. Raising a hard limit requires CAP_SYS_RESOURCE.
+func setRlimits(rlimits []specRlimit) error {
+	for _, rlimit := range rlimits {
+		resource, ok := rlimitNumbers()[rlimit.Type]
+		if !ok {
+			return errors.WithStack(ErrUnknownRlimit)
+		}
+
+		// syscall package keeps a raised RLIMIT_NOFILE of the Go runtime for execve(2), unless it's set through the package.
+		if err := syscall.Setrlimit(resource, &syscall.Rlimit{Cur: rlimit.Soft, Max: rlimit.Hard}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// setOOMScoreAdj adjusts the OOM killer score of the process, which is inherited by the command.
+// Lowering it requires CAP_SYS_RESOURCE.
+func setOOMScoreAdj(score int) error {
+	if score < minOOMScoreAdj || score > maxOOMScoreAdj {
+		return errors.WithStack(ErrInvalidOOMScoreAdj)
+	}
+
+	if err := os.WriteFile("/proc/self/oom_score_adj", []byte(strconv.Itoa(score)), 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseUlimit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		value   string
+		want    specRlimit
+		wantErr error
+	}{
+		{name: "soft only", value: "nofile=1024", want: specRlimit{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 1024}},
+		{name: "soft and hard", value: "nofile=1024:2048", want: specRlimit{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 2048}},
+		{name: "upper case", value: "NPROC=10", want: specRlimit{Type: "RLIMIT_NPROC", Soft: 10, Hard: 10}},
+		{name: "unlimited", value: "core=0:-1", want: specRlimit{Type: "RLIMIT_CORE", Soft: 0, Hard: unix.RLIM_INFINITY}},
+		{name: "unlimited soft", value: "memlock=-1", want: specRlimit{Type: "RLIMIT_MEMLOCK", Soft: unix.RLIM_INFINITY, Hard: unix.RLIM_INFINITY}},
+		{name: "no limits", value: "nofile", wantErr: ErrInvalidUlimit},
+		{name: "empty soft", value: "nofile=:2048", wantErr: ErrInvalidUlimit},
+		{name: "empty hard", value: "nofile=1024:", wantErr: ErrInvalidUlimit},
+		{name: "negative", value: "nofile=-2", wantErr: ErrInvalidUlimit},
+		{name: "prefixed", value: "RLIMIT_NOFILE=1024", wantErr: ErrUnknownRlimit},
+		{name: "unknown", value: "foo=1", wantErr: ErrUnknownRlimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseUlimit(tt.value)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("parseUlimit(%q) error = %v, want %v", tt.value, err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Errorf("parseUlimit(%q) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"slices"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+// defaultMounts returns the pseudo filesystems of a container whose spec has no mounts, in the order to be mounted.
+func defaultMounts() []specMount {
+	return []specMount{
+		{Destination: "/proc", Type: "proc", Source: "proc", Options: []string{"nosuid", "noexec", "nodev"}},
+		{Destination: "/sys", Type: "sysfs", Source: "sysfs", Options: []string{"nosuid", "noexec", "nodev", "ro"}},
+		{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+		{
+			Destination: "/dev/pts", Type: "devpts", Source: "devpts",
+			Options: []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620"},
+		},
+		{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"}},
+		{Destination: "/dev/mqueue", Type: "mqueue", Source: "mqueue", Options: []string{"nosuid", "noexec", "nodev"}},
+	}
+}
+
+// setupRootfs populates the mounts of rootfs, which pivotRoot switches the root filesystem to afterwards.
+// The files in etcDir, if any, are bind-mounted onto /etc of rootfs.
+func setupRootfs(spec *spec, etcDir string) error {
+	rootfs := spec.Root.Path
+
+	// Stop mount events from propagating back to the host.
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// pivot_root(2) requires the new root to be a mount point.
+	if err := unix.Mount(rootfs, rootfs, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, mount := range spec.Mounts {
+		err := mountInto(rootfs, mount)
+		if errors.Is(err, unix.EPERM) && slices.Contains([]string{"proc", "sysfs", "mqueue"}, mount.Type) {
+			// A user namespace can't mount these without owning the pid, network or IPC namespace,
+			// so fall back to the ones of the host, if any.
+			if _, statErr := os.Stat(mount.Destination); os.IsNotExist(statErr) {
+				continue
+			}
+
+			options := append([]string{"rbind"}, mount.Options...)
+			err = mountInto(rootfs, specMount{Destination: mount.Destination, Type: "bind", Source: mount.Destination, Options: options})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	nodes := append(defaultDevices(), spec.Linux.Devices...)
+	if err := createDevices(rootfs, nodes, hasNamespace(spec.Linux.Namespaces, "user")); err != nil {
+		return err
+	}
+
+	// /dev/ptmx must point to the devpts instance of the container.
+	dev, err := openMountPoint(rootfs, "/dev", true)
+	if err != nil {
+		return err
+	}
+
+	err = unix.Symlinkat("pts/ptmx", int(dev.Fd()), "ptmx")
+	dev.Close()
+
+	if err != nil && !errors.Is(err, unix.EEXIST) {
+		return errors.WithStack(err)
+	}
+
+	if etcDir != "" {
+		if err := mountEtcFiles(rootfs, etcDir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func pivotRoot(rootfs string) error {
+	if err := unix.Chdir(rootfs); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Stack the new root on top of the old one, so that no directory is needed to put the old root.
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := unix.Chdir("/"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// finishRootfs restricts the root filesystem after pivot_root(2), once nothing needs to be written there anymore.
+func finishRootfs(spec *spec) error {
+	if err := maskPaths(spec.Linux.MaskedPaths); err != nil {
+		return err
+	}
+
+	if err := readonlyPaths(spec.Linux.ReadonlyPaths); err != nil {
+		return err
+	}
+
+	if spec.Root.Readonly {
+		if err := remountBind("/", unix.MS_RDONLY); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
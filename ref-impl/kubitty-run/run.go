@@ -0,0 +1,292 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/k1LoW/errors"
+)
+
+// runFlags is the command line of "kubitty-run run", from which the spec of the container is built.
+type runFlags struct {
+	namespaces      *namespaceFlags
+	rootfs          *string
+	hostname        *string
+	domainname      *string
+	devices         *deviceFlags
+	mounts          *mountFlags
+	init            *bool
+	sysctl          map[string]string
+	network         *networkFlags
+	readonly        *bool
+	etcFiles        *bool
+	cgroupParent    *string
+	resources       *resourceFlags
+	capabilities    *capabilityFlags
+	idMappings      *idMappingFlags
+	seccomp         *string
+	noNewPrivileges *bool
+	tty             *bool
+	consoleSocket   *string
+	user            *userFlags
+	cwd             *string
+	rlimits         *[]specRlimit
+	// oomScoreAdj is nil unless the flag is given, since only then it differs from the one inherited.
+	oomScoreAdj *int
+	env         []string
+}
+
+func registerRunFlags(flags *flag.FlagSet) *runFlags {
+	runFlags := &runFlags{
+		namespaces:      registerNamespaceFlags(flags),
+		rootfs:          flags.String("rootfs", "", "directory to be used as the root filesystem of the container"),
+		hostname:        flags.String("hostname", "", "hostname of the container, which requires the UTS namespace"),
+		domainname:      flags.String("domainname", "", "NIS domain name of the container, which requires the UTS namespace"),
+		devices:         registerDeviceFlags(flags),
+		mounts:          registerMountFlags(flags),
+		init:            flags.Bool("init", false, "run a minimal init as PID 1 which forwards signals to the command and reaps zombies, enabling the PID namespace"),
+		sysctl:          registerSysctlFlags(flags),
+		network:         registerNetworkFlags(flags),
+		readonly:        flags.Bool("read-only", false, "mount the rootfs read-only"),
+		etcFiles:        flags.Bool("etc-files", false, "generate /etc/hostname, /etc/hosts and /etc/resolv.conf and bind-mount them into the rootfs"),
+		cgroupParent:    flags.String("cgroup-parent", defaultCgroupParent, "parent cgroup of the container, relative to the cgroup root"),
+		resources:       registerResourceFlags(flags),
+		capabilities:    registerCapabilityFlags(flags),
+		idMappings:      registerIDMappingFlags(flags),
+		seccomp:         flags.String("seccomp", seccompUnconfined, `seccomp profile, "runtime/default", "unconfined" or a path to a JSON profile`),
+		noNewPrivileges: flags.Bool("no-new-privileges", false, "prevent the command from gaining privileges on execve(2)"),
+		tty:             flags.Bool("tty", false, "allocate a pseudo terminal for the command"),
+		consoleSocket:   flags.String("console-socket", "", "unix socket to receive the master of the pseudo terminal, instead of relaying it"),
+		user:            registerUserFlags(flags),
+		cwd:             flags.String("cwd", "", "working directory of the command in the container, defaulting to the current one"),
+		rlimits:         registerUlimitFlags(flags),
+	}
+
+	flags.Func("oom-score-adj", "oom_score_adj of the command, inherited from the runtime if not set", func(value string) error {
+		adj, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		runFlags.oomScoreAdj = &adj
+
+		return nil
+	})
+	flags.Func("env", "environment variable in the form of KEY=VALUE, added to PATH and TERM by default (repeatable)",
+		func(value string) error {
+			runFlags.env = append(runFlags.env, value)
+
+			return nil
+		})
+
+	return runFlags
+}
+
+// run executes a command in a new container built from the command line, and waits for it to exit.
+func run(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	runFlags := registerRunFlags(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	command := flags.Args()
+	if len(command) == 0 {
+		return errors.WithStack(ErrNoCommand)
+	}
+
+	// The runtime has no container ID in this mode, so its pid distinguishes the cgroup.
+	name := fmt.Sprintf("run-%d", os.Getpid())
+
+	config, err := runFlags.config(name, command)
+	if err != nil {
+		return err
+	}
+
+	if *runFlags.etcFiles {
+		dir, err := os.MkdirTemp("", name+"-")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := generateRunEtcFiles(dir, config); err != nil {
+			return err
+		}
+	}
+
+	cg, err := setupCgroup(config.Spec.Linux, name)
+	if err != nil {
+		return err
+	}
+
+	if cg != nil {
+		defer cg.destroy() //nolint:errcheck // best effort cleanup
+	}
+
+	return runInit(config, initOptions{cgroup: cg}, *runFlags.consoleSocket)
+}
+
+// config builds the config of the container named name, which runs command.
+func (f *runFlags) config(name string, command []string) (*containerConfig, error) {
+	network, err := f.network.network()
+	if err != nil {
+		return nil, err
+	}
+
+	linux, err := f.linuxSpec(name)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &spec{
+		OCIVersion: specVersion,
+		Hostname:   *f.hostname,
+		Domainname: *f.domainname,
+		Process:    f.processSpec(command),
+		Linux:      linux,
+	}
+
+	if *f.rootfs != "" {
+		path, err := filepath.Abs(*f.rootfs)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		spec.Root = &specRoot{Path: path, Readonly: *f.readonly}
+		spec.Mounts = append(defaultMounts(), *f.mounts...)
+	}
+
+	if spec.Linux.Namespaces, err = f.enabledNamespaces(network); err != nil {
+		return nil, err
+	}
+
+	if err := validateHostname(spec); err != nil {
+		return nil, err
+	}
+
+	if err := validateSysctls(spec); err != nil {
+		return nil, err
+	}
+
+	return &containerConfig{Spec: spec, Init: *f.init, Network: network}, nil
+}
+
+func (f *runFlags) processSpec(command []string) *specProcess {
+	return &specProcess{
+		Terminal:        *f.tty,
+		User:            f.user.user,
+		Args:            command,
+		Env:             mergeEnv(defaultEnv(*f.tty), f.env),
+		Cwd:             *f.cwd,
+		Capabilities:    f.capabilities.capabilities(),
+		Rlimits:         *f.rlimits,
+		NoNewPrivileges: *f.noNewPrivileges,
+		OOMScoreAdj:     f.oomScoreAdj,
+	}
+}
+
+func (f *runFlags) linuxSpec(name string) (*specLinux, error) {
+	profile, err := loadSeccompProfile(*f.seccomp)
+	if err != nil {
+		return nil, err
+	}
+
+	linux := &specLinux{
+		CgroupsPath: filepath.Join("/", *f.cgroupParent, name),
+		Resources:   f.resources.resources(),
+		Seccomp:     profile,
+		Sysctl:      f.sysctl,
+		UIDMappings: f.idMappings.uid,
+		GIDMappings: f.idMappings.gid,
+		Devices:     *f.devices,
+	}
+
+	fillIDMappings(linux)
+
+	return linux, nil
+}
+
+// enabledNamespaces adds the namespaces the other flags depend on to those selected.
+func (f *runFlags) enabledNamespaces(network *networkConfig) ([]specNamespace, error) {
+	if *f.rootfs != "" {
+		// The root filesystem can only be switched in its own mount namespace.
+		f.namespaces.enable("mnt")
+	}
+
+	if *f.init {
+		// The init is PID 1, to which orphans are reparented, only in its own PID namespace.
+		f.namespaces.enable("pid")
+	}
+
+	if network != nil {
+		if f.namespaces.joined("net") {
+			return nil, errors.WithStack(ErrNetworkJoined)
+		}
+
+		// The container side of the veth pair needs a namespace to be moved into.
+		f.namespaces.enable("net")
+	}
+
+	if rootless() || len(f.idMappings.uid)+len(f.idMappings.gid) > 0 {
+		// Other namespaces can be created without privileges only by the owner of a user namespace.
+		f.namespaces.enable("user")
+	}
+
+	return f.namespaces.namespaces(), nil
+}
+
+// generateRunEtcFiles generates the files for /etc of the container under dir, a temporary directory removed after the run.
+func generateRunEtcFiles(dir string, config *containerConfig) error {
+	// The root of a user namespace may be mapped to another user than the owner.
+	if err := os.Chmod(dir, stateDirPermission); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var err error
+
+	config.EtcDir, err = generateEtcFiles(dir, config.Spec)
+
+	return err
+}
+
+// runInit starts the process in the foreground, and turns its exit status into that of the runtime.
+func runInit(config *containerConfig, opts initOptions, consoleSocket string) error {
+	process, err := startInit(config, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := process.waitReady(nil, nil); err != nil {
+		process.kill()
+
+		return err
+	}
+
+	proxy, err := process.attachConsole(consoleSocket)
+	if err != nil {
+		process.kill()
+
+		return err
+	}
+
+	code, err := process.wait()
+
+	if proxy != nil {
+		proxy.stop()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if code != 0 {
+		return &exitCodeError{code: code}
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/k1LoW/errors"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/seccomp"
+)
+
+const seccompUnconfined = "unconfined"
+
+// loadSeccompProfile resolves the value of --seccomp, which is a profile name or a path to a JSON profile.
+func loadSeccompProfile(value string) (*seccomp.Profile, error) {
+	switch value {
+	case "", seccompUnconfined:
+		return nil, nil //nolint:nilnil // no profile is a valid result
+	case seccomp.DefaultProfileName:
+		return seccomp.DefaultProfile(), nil
+	}
+
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	profile := &seccomp.Profile{}
+	if err := json.Unmarshal(data, profile); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return profile, nil
+}
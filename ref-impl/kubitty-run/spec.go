@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/k1LoW/errors"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/devices"
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/seccomp"
+)
+
+const (
+	specVersion    = "1.2.0"
+	specConfigName = "config.json"
+)
+
+var ErrInvalidSpec = errors.New("invalid runtime spec")
+
+// spec is the subset of the OCI runtime spec (config.json) kubitty-run understands.
+type spec struct {
+	OCIVersion  string            `json:"ociVersion"`
+	Process     *specProcess      `json:"process,omitempty"`
+	Root        *specRoot         `json:"root,omitempty"`
+	Mounts      []specMount       `json:"mounts,omitempty"`
+	Hostname    string            `json:"hostname,omitempty"`
+	Domainname  string            `json:"domainname,omitempty"`
+	Hooks       *specHooks        `json:"hooks,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Linux       *specLinux        `json:"linux,omitempty"`
+}
+
+type specProcess struct {
+	Terminal bool     `json:"terminal,omitempty"`
+	User     specUser `json:"user"`
+	Args     []string `json:"args"`
+	Env      []string `json:"env,omitempty"`
+	// Cwd is the working directory in the container. Empty means the one of the runtime.
+	Cwd             string            `json:"cwd,omitempty"`
+	Capabilities    *specCapabilities `json:"capabilities,omitempty"`
+	Rlimits         []specRlimit      `json:"rlimits,omitempty"`
+	NoNewPrivileges bool              `json:"noNewPrivileges,omitempty"`
+	OOMScoreAdj     *int              `json:"oomScoreAdj,omitempty"`
+}
+
+type specUser struct {
+	UID            uint32   `json:"uid"`
+	GID            uint32   `json:"gid"`
+	Umask          *uint32  `json:"umask,omitempty"`
+	AdditionalGids []uint32 `json:"additionalGids,omitempty"`
+}
+
+type specRlimit struct {
+	Type string `json:"type"`
+	Hard uint64 `json:"hard"`
+	Soft uint64 `json:"soft"`
+}
+
+type specCapabilities struct {
+	Bounding    []string `json:"bounding,omitempty"`
+	Effective   []string `json:"effective,omitempty"`
+	Permitted   []string `json:"permitted,omitempty"`
+	Inheritable []string `json:"inheritable,omitempty"`
+	Ambient     []string `json:"ambient,omitempty"`
+}
+
+type specRoot struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly,omitempty"`
+}
+
+type specLinux struct {
+	Namespaces  []specNamespace `json:"namespaces,omitempty"`
+	UIDMappings []specIDMapping `json:"uidMappings,omitempty"`
+	GIDMappings []specIDMapping `json:"gidMappings,omitempty"`
+	Devices     []specDevice    `json:"devices,omitempty"`
+	// MaskedPaths and ReadonlyPaths are applied after pivot_root(2). Missing paths are ignored.
+	MaskedPaths   []string `json:"maskedPaths,omitempty"`
+	ReadonlyPaths []string `json:"readonlyPaths,omitempty"`
+	// CgroupsPath is relative to the cgroup root if absolute, otherwise relative to the default parent.
+	CgroupsPath string           `json:"cgroupsPath,omitempty"`
+	Resources   *specResources   `json:"resources,omitempty"`
+	Seccomp     *seccomp.Profile `json:"seccomp,omitempty"`
+	// Sysctl is written after the namespaces are created, so only namespaced ones are allowed.
+	Sysctl map[string]string `json:"sysctl,omitempty"`
+}
+
+type specNamespace struct {
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+}
+
+type specIDMapping struct {
+	ContainerID uint32 `json:"containerID"` //nolint:tagliatelle // defined by the spec
+	HostID      uint32 `json:"hostID"`      //nolint:tagliatelle // defined by the spec
+	Size        uint32 `json:"size"`
+}
+
+type specResources struct {
+	Memory  *specMemory       `json:"memory,omitempty"`
+	CPU     *specCPU          `json:"cpu,omitempty"`
+	Pids    *specPids         `json:"pids,omitempty"`
+	BlockIO *specBlockIO      `json:"blockIO,omitempty"`
+	Unified map[string]string `json:"unified,omitempty"`
+	Devices []devices.Rule    `json:"devices,omitempty"`
+}
+
+type specMemory struct {
+	Limit *int64 `json:"limit,omitempty"`
+	// Swap is the limit of memory plus swap, as cgroup v1 defines.
+	Swap *int64 `json:"swap,omitempty"`
+}
+
+type specCPU struct {
+	Shares *uint64 `json:"shares,omitempty"`
+	Quota  *int64  `json:"quota,omitempty"`
+	Period *uint64 `json:"period,omitempty"`
+}
+
+type specPids struct {
+	Limit int64 `json:"limit"`
+}
+
+type specBlockIO struct {
+	ThrottleReadBpsDevice   []specThrottleDevice `json:"throttleReadBpsDevice,omitempty"`
+	ThrottleWriteBpsDevice  []specThrottleDevice `json:"throttleWriteBpsDevice,omitempty"`
+	ThrottleReadIOPSDevice  []specThrottleDevice `json:"throttleReadIOPSDevice,omitempty"`  //nolint:tagliatelle // defined by the spec
+	ThrottleWriteIOPSDevice []specThrottleDevice `json:"throttleWriteIOPSDevice,omitempty"` //nolint:tagliatelle // defined by the spec
+}
+
+type specThrottleDevice struct {
+	Major int64  `json:"major"`
+	Minor int64  `json:"minor"`
+	Rate  uint64 `json:"rate"`
+}
+
+// saveSpec writes the spec as config.json under dir.
+func saveSpec(dir string, config *spec) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, specConfigName), data, stateFilePermission); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// loadSpec reads config.json of the bundle and resolves the root path against the bundle directory.
+func loadSpec(bundle string) (*spec, error) {
+	data, err := os.ReadFile(filepath.Join(bundle, specConfigName))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	config := &spec{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if config.Process == nil || len(config.Process.Args) == 0 || config.Root == nil {
+		return nil, errors.WithStack(ErrInvalidSpec)
+	}
+
+	if !filepath.IsAbs(config.Root.Path) {
+		config.Root.Path = filepath.Join(bundle, config.Root.Path)
+	}
+
+	if config.Hooks != nil {
+		if err := config.Hooks.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Process.Capabilities == nil {
+		config.Process.Capabilities = defaultSpecCapabilities()
+	}
+
+	if err := config.Process.Capabilities.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Linux == nil {
+		config.Linux = &specLinux{}
+	}
+
+	// Bundles without mounts get the same pseudo filesystems as "kubitty-run run".
+	if len(config.Mounts) == 0 {
+		config.Mounts = defaultMounts()
+	}
+
+	fillIDMappings(config.Linux)
+
+	if err := validateHostname(config); err != nil {
+		return nil, err
+	}
+
+	if err := validateSysctls(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+var ErrStartFailed = errors.New("container exited before executing the user-specified program")
+
+// start lets the user-specified program of a created container run.
+func start(args []string) error {
+	flags := flag.NewFlagSet("start", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return withContainer(flags.Arg(0), unix.LOCK_EX, func(state *containerState) error {
+		return startContainer(state)
+	})
+}
+
+func startContainer(state *containerState) error {
+	if state.Status != statusCreated {
+		return errors.WithStack(ErrInvalidStatus)
+	}
+
+	fifoPath := filepath.Join(stateDir(state.ID), execFifoName)
+
+	// Opening the FIFO for reading unblocks the init process waiting in waitStart.
+	fifo, err := os.OpenFile(fifoPath, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer fifo.Close()
+
+	// The init process writes to the FIFO after startContainer hooks succeed, and closes it on execve(2).
+	data, err := io.ReadAll(fifo)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.Remove(fifoPath); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(data) == 0 {
+		return errors.WithStack(ErrStartFailed)
+	}
+
+	state.Status = statusRunning
+
+	if err := saveState(state); err != nil {
+		return err
+	}
+
+	spec, err := loadSpec(stateDir(state.ID))
+	if err != nil {
+		return err
+	}
+
+	if spec.Hooks != nil {
+		runHooksIgnoringErrors(spec.Hooks.Poststart, state)
+	}
+
+	return nil
+}
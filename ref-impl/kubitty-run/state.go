@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+// queryState prints the OCI state of a container.
+func queryState(args []string) error {
+	flags := flag.NewFlagSet("state", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return withContainer(flags.Arg(0), unix.LOCK_SH, func(state *containerState) error {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(state); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+}
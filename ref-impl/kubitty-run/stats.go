@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/k1LoW/errors"
+)
+
+var ErrInvalidIOStat = errors.New("invalid format of io.stat")
+
+// containerStats is the resource usage of a container. Controllers not enabled in its cgroup are omitted.
+type containerStats struct {
+	ID     string          `json:"id"`
+	CPU    *cpuStats       `json:"cpu,omitempty"`
+	Memory *memoryStats    `json:"memory,omitempty"`
+	Pids   *pidsStats      `json:"pids,omitempty"`
+	IO     []ioDeviceStats `json:"io,omitempty"`
+}
+
+type cpuStats struct {
+	UsageUsec     uint64 `json:"usageUsec"`
+	UserUsec      uint64 `json:"userUsec"`
+	SystemUsec    uint64 `json:"systemUsec"`
+	Periods       uint64 `json:"periods"`
+	Throttled     uint64 `json:"throttled"`
+	ThrottledUsec uint64 `json:"throttledUsec"`
+}
+
+// memoryStats is in bytes. A nil limit means unlimited.
+type memoryStats struct {
+	Usage     uint64            `json:"usage"`
+	Limit     *uint64           `json:"limit,omitempty"`
+	SwapUsage uint64            `json:"swapUsage"`
+	SwapLimit *uint64           `json:"swapLimit,omitempty"`
+	Stat      map[string]uint64 `json:"stat"`
+}
+
+// pidsStats is the number of tasks. A nil limit means unlimited.
+type pidsStats struct {
+	Current uint64  `json:"current"`
+	Limit   *uint64 `json:"limit,omitempty"`
+}
+
+type ioDeviceStats struct {
+	Major        uint64 `json:"major"`
+	Minor        uint64 `json:"minor"`
+	ReadBytes    uint64 `json:"readBytes"`
+	WriteBytes   uint64 `json:"writeBytes"`
+	ReadIOs      uint64 `json:"readIOs"`
+	WriteIOs     uint64 `json:"writeIOs"`
+	DiscardBytes uint64 `json:"discardBytes"`
+	DiscardIOs   uint64 `json:"discardIOs"`
+}
+
+// stats prints the resource usage of a container in JSON, read from the stat files of its cgroup.
+func stats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	cg, err := lookupCgroup(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	result := &containerStats{ID: flags.Arg(0)}
+
+	// The files of a controller don't exist unless the controller is enabled in the parent.
+	if result.CPU, err = cg.cpuStats(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if result.Memory, err = cg.memoryStats(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if result.Pids, err = cg.pidsStats(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if result.IO, err = cg.ioStats(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(result); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (c *cgroup) cpuStats() (*cpuStats, error) {
+	values, err := c.readKeyedFile("cpu.stat")
+	if err != nil {
+		return nil, err
+	}
+
+	// The throttling statistics are only present when the cpu controller is enabled.
+	return &cpuStats{
+		UsageUsec:     values["usage_usec"],
+		UserUsec:      values["user_usec"],
+		SystemUsec:    values["system_usec"],
+		Periods:       values["nr_periods"],
+		Throttled:     values["nr_throttled"],
+		ThrottledUsec: values["throttled_usec"],
+	}, nil
+}
+
+func (c *cgroup) memoryStats() (*memoryStats, error) {
+	memory := &memoryStats{}
+
+	var err error
+
+	if memory.Usage, err = c.readUint("memory.current"); err != nil {
+		return nil, err
+	}
+
+	if memory.Limit, err = c.readLimit("memory.max"); err != nil {
+		return nil, err
+	}
+
+	if memory.Stat, err = c.readKeyedFile("memory.stat"); err != nil {
+		return nil, err
+	}
+
+	// Swap accounting may be disabled in the kernel.
+	if memory.SwapUsage, err = c.readUint("memory.swap.current"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if memory.SwapLimit, err = c.readLimit("memory.swap.max"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return memory, nil
+}
+
+func (c *cgroup) pidsStats() (*pidsStats, error) {
+	pids := &pidsStats{}
+
+	var err error
+
+	if pids.Current, err = c.readUint("pids.current"); err != nil {
+		return nil, err
+	}
+
+	if pids.Limit, err = c.readLimit("pids.max"); err != nil {
+		return nil, err
+	}
+
+	return pids, nil
+}
+
+// ioStats parses io.stat, whose lines are in the form of "MAJOR:MINOR KEY=VALUE...".
+func (c *cgroup) ioStats() ([]ioDeviceStats, error) {
+	data, err := c.readFile("io.stat")
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []ioDeviceStats{}
+
+	for line := range strings.Lines(data) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		major, minor, ok := strings.Cut(fields[0], ":")
+		if !ok {
+			return nil, errors.WithStack(ErrInvalidIOStat)
+		}
+
+		device := ioDeviceStats{}
+		if device.Major, err = strconv.ParseUint(major, 10, 32); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if device.Minor, err = strconv.ParseUint(minor, 10, 32); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		counters := map[string]*uint64{
+			"rbytes": &device.ReadBytes,
+			"wbytes": &device.WriteBytes,
+			"rios":   &device.ReadIOs,
+			"wios":   &device.WriteIOs,
+			"dbytes": &device.DiscardBytes,
+			"dios":   &device.DiscardIOs,
+		}
+
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, errors.WithStack(ErrInvalidIOStat)
+			}
+
+			// Ignore keys added by newer kernels.
+			counter, known := counters[key]
+			if !known {
+				continue
+			}
+
+			if *counter, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
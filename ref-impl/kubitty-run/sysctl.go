@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/k1LoW/errors"
+)
+
+const procSysDir = "/proc/sys"
+
+var (
+	ErrInvalidSysctl           = errors.New(`sysctl must be in the form of "KEY=VALUE" with a dot separated key`)
+	ErrSysctlNotNamespaced     = errors.New("sysctl is not namespaced, so setting it would change the host")
+	ErrSysctlNamespaceRequired = errors.New("sysctl requires its namespace to be unshared")
+)
+
+// registerSysctlFlags registers --sysctl, whose values are put into the returned map.
+func registerSysctlFlags(flags *flag.FlagSet) map[string]string {
+	sysctl := map[string]string{}
+
+	flags.Func("sysctl", `namespaced kernel parameter in the form of "KEY=VALUE" like "net.ipv4.ip_forward=1" (repeatable)`,
+		func(value string) error {
+			key, value, ok := strings.Cut(value, "=")
+			if !ok {
+				return errors.WithStack(ErrInvalidSysctl)
+			}
+
+			sysctl[key] = value
+
+			return nil
+		})
+
+	return sysctl
+}
+
+// sysctlNamespace returns the OCI type of the namespace a sysctl belongs to, or an empty string if it isn't namespaced.
+func sysctlNamespace(key string) string {
+	switch {
+	case strings.HasPrefix(key, "net."):
+		return "network"
+	case key == "kernel.sem", strings.HasPrefix(key, "kernel.shm"), strings.HasPrefix(key, "kernel.msg"),
+		strings.HasPrefix(key, "fs.mqueue."):
+		return "ipc"
+	case key == "kernel.hostname", key == "kernel.domainname":
+		return "uts"
+	default:
+		return ""
+	}
+}
+
+// validateSysctls rejects sysctls that would end up changing those of the host.
+func validateSysctls(spec *spec) error {
+	for key := range spec.Linux.Sysctl {
+		// Each component becomes a directory under /proc/sys, which must not escape from it.
+		if strings.Contains(key, "/") || slices.Contains(strings.Split(key, "."), "") {
+			return errors.WithStack(fmt.Errorf("%w: %s", ErrInvalidSysctl, key))
+		}
+
+		nsType := sysctlNamespace(key)
+		if nsType == "" {
+			return errors.WithStack(fmt.Errorf("%w: %s", ErrSysctlNotNamespaced, key))
+		}
+
+		if !createsNamespace(spec.Linux.Namespaces, nsType) {
+			return errors.WithStack(fmt.Errorf("%w: %s needs a new %s namespace", ErrSysctlNamespaceRequired, key, nsType))
+		}
+	}
+
+	return nil
+}
+
+// setSysctls writes the sysctls, which apply to the namespaces of the current process.
+func setSysctls(sysctl map[string]string) error {
+	for _, key := range slices.Sorted(maps.Keys(sysctl)) {
+		path := filepath.Join(procSysDir, strings.ReplaceAll(key, ".", "/"))
+		if err := os.WriteFile(path, []byte(sysctl[key]), 0); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateSysctls(t *testing.T) {
+	t.Parallel()
+
+	all := []specNamespace{{Type: "network"}, {Type: "ipc"}, {Type: "uts"}}
+
+	tests := []struct {
+		name       string
+		sysctl     map[string]string
+		namespaces []specNamespace
+		wantErr    error
+	}{
+		{name: "none", sysctl: nil, namespaces: nil},
+		{name: "net", sysctl: map[string]string{"net.ipv4.ip_forward": "1"}, namespaces: all},
+		{
+			name:       "ipc",
+			sysctl:     map[string]string{"kernel.sem": "250 32000 32 128", "kernel.shmmax": "1", "kernel.msgmax": "1", "fs.mqueue.msg_max": "1"},
+			namespaces: all,
+		},
+		{name: "uts", sysctl: map[string]string{"kernel.hostname": "kubitty", "kernel.domainname": "local"}, namespaces: all},
+		{name: "not namespaced", sysctl: map[string]string{"kernel.pid_max": "1"}, namespaces: all, wantErr: ErrSysctlNotNamespaced},
+		{name: "prefix of a namespaced one", sysctl: map[string]string{"kernel.semaphores": "1"}, namespaces: all, wantErr: ErrSysctlNotNamespaced},
+		{name: "namespace not created", sysctl: map[string]string{"net.ipv4.ip_forward": "1"}, wantErr: ErrSysctlNamespaceRequired},
+		{
+			name:       "namespace joined",
+			sysctl:     map[string]string{"net.ipv4.ip_forward": "1"},
+			namespaces: []specNamespace{{Type: "network", Path: "/run/netns/test"}},
+			wantErr:    ErrSysctlNamespaceRequired,
+		},
+		{name: "escaping with a slash", sysctl: map[string]string{"net/../../kernel/pid_max": "1"}, namespaces: all, wantErr: ErrInvalidSysctl},
+		{name: "empty component", sysctl: map[string]string{"net..ipv4": "1"}, namespaces: all, wantErr: ErrInvalidSysctl},
+		{name: "trailing dot", sysctl: map[string]string{"net.ipv4.": "1"}, namespaces: all, wantErr: ErrInvalidSysctl},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateSysctls(&spec{Linux: &specLinux{Sysctl: tt.sysctl, Namespaces: tt.namespaces}})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateSysctls(%v) error = %v, want %v", tt.sysctl, err, tt.wantErr)
+			}
+		})
+	}
+}
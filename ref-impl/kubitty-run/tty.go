@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	ErrConsoleSocketRequired = errors.New("a detached container with a terminal requires --console-socket")
+	ErrNotUnixConn           = errors.New("console socket is not a unix socket")
+)
+
+// openPty opens a new pseudo terminal pair from /dev/ptmx, which is the devpts instance of the container.
+func openPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	if err := unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+
+		return nil, nil, errors.WithStack(err)
+	}
+
+	num, err := unix.IoctlGetUint32(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+
+		return nil, nil, errors.WithStack(err)
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", num), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+
+		return nil, nil, errors.WithStack(err)
+	}
+
+	return master, slave, nil
+}
+
+// setupConsole makes the slave the controlling terminal and the standard streams of the current process.
+func setupConsole(slave *os.File) error {
+	// Only a session leader without a controlling terminal can acquire one.
+	if _, err := unix.Setsid(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := unix.IoctlSetInt(int(slave.Fd()), unix.TIOCSCTTY, 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, fd := range []int{unix.Stdin, unix.Stdout, unix.Stderr} {
+		if err := unix.Dup3(int(slave.Fd()), fd, 0); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// handOverConsole sends the master of the pseudo terminal to the process listening on socketPath, as runc does.
+func handOverConsole(socketPath string, console *os.File) error {
+	defer console.Close()
+
+	conn, err := (&net.Dialer{}).DialContext(context.Background(), "unix", socketPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return errors.WithStack(ErrNotUnixConn)
+	}
+
+	if _, _, err := unixConn.WriteMsgUnix([]byte(console.Name()), unix.UnixRights(int(console.Fd())), nil); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// attachConsole hands the console of the process over to the socket if any, or relays it to the standard streams.
+// It returns nil when the process has no console, or the console has been handed over.
+func (p *initProcess) attachConsole(socketPath string) (*consoleProxy, error) {
+	console := p.console
+	if console == nil {
+		return nil, nil //nolint:nilnil // no console to relay
+	}
+
+	p.console = nil
+
+	if socketPath != "" {
+		return nil, handOverConsole(socketPath, console)
+	}
+
+	return startConsoleProxy(console), nil
+}
+
+// consoleProxy relays the standard streams of the runtime to the console of the container.
+type consoleProxy struct {
+	console *os.File
+	// restore returns the terminal of the caller to its original mode.
+	restore func()
+	resize  chan os.Signal
+	output  chan struct{}
+}
+
+func startConsoleProxy(console *os.File) *consoleProxy {
+	proxy := &consoleProxy{
+		console: console,
+		restore: func() {},
+		resize:  make(chan os.Signal, 1),
+		output:  make(chan struct{}),
+	}
+
+	if termios, err := unix.IoctlGetTermios(unix.Stdin, unix.TCGETS); err == nil {
+		// Keystrokes like Ctrl-C must reach the terminal of the container as they are.
+		raw := *termios
+		makeRaw(&raw)
+
+		if err := unix.IoctlSetTermios(unix.Stdin, unix.TCSETS, &raw); err == nil {
+			proxy.restore = func() { _ = unix.IoctlSetTermios(unix.Stdin, unix.TCSETS, termios) }
+		}
+
+		signal.Notify(proxy.resize, unix.SIGWINCH)
+		proxy.resize <- unix.SIGWINCH
+
+		go proxy.propagateResize()
+	}
+
+	go func() {
+		_, _ = io.Copy(console, os.Stdin)
+	}()
+
+	go func() {
+		// Reading the master fails with EIO once every slave is closed.
+		_, _ = io.Copy(os.Stdout, console)
+
+		close(proxy.output)
+	}()
+
+	return proxy
+}
+
+func (p *consoleProxy) propagateResize() {
+	for range p.resize {
+		if size, err := unix.IoctlGetWinsize(unix.Stdin, unix.TIOCGWINSZ); err == nil {
+			_ = unix.IoctlSetWinsize(int(p.console.Fd()), unix.TIOCSWINSZ, size)
+		}
+	}
+}
+
+// stop waits for the remaining output of the container and restores the terminal of the caller.
+func (p *consoleProxy) stop() {
+	<-p.output
+
+	signal.Stop(p.resize)
+	close(p.resize)
+	p.restore()
+	p.console.Close()
+}
+
+// makeRaw does what cfmakeraw(3) does.
+func makeRaw(termios *unix.Termios) {
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	ErrNoResources      = errors.New("no resource to update")
+	ErrDevicesUpdate    = errors.New("device rules can't be updated")
+	ErrMemoryBelowUsage = errors.New("memory limit is below the current usage")
+)
+
+// update changes the resource limits of a container, and records them in its saved spec.
+func update(args []string) error {
+	flags := flag.NewFlagSet("update", flag.ContinueOnError)
+	resourcesPath := flags.String("resources", "", `JSON file of OCI linux.resources, or "-" for stdin, whose sections flags override`)
+	resFlags := registerResourceFlags(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	resources, err := loadResources(*resourcesPath)
+	if err != nil {
+		return err
+	}
+
+	resources = mergeResources(resources, resFlags.resources())
+	if resources == nil {
+		return errors.WithStack(ErrNoResources)
+	}
+
+	if len(resources.Devices) > 0 {
+		return errors.WithStack(ErrDevicesUpdate)
+	}
+
+	return withContainer(flags.Arg(0), unix.LOCK_EX, func(state *containerState) error {
+		if state.Status == statusStopped {
+			return errors.WithStack(ErrInvalidStatus)
+		}
+
+		cg := containerCgroup(state)
+		if cg == nil {
+			return errors.WithStack(ErrNoCgroup)
+		}
+
+		spec, err := loadSpec(stateDir(state.ID))
+		if err != nil {
+			return err
+		}
+
+		// Write the merged resources, so that the values depending on others like memory.swap.max stay consistent.
+		spec.Linux.Resources = mergeResources(spec.Linux.Resources, resources)
+		if err := cg.update(spec.Linux.Resources); err != nil {
+			return err
+		}
+
+		return saveSpec(stateDir(state.ID), spec)
+	})
+}
+
+// loadResources reads resources in JSON from path, where "-" means stdin. An empty path means no resources.
+func loadResources(path string) (*specResources, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	switch path {
+	case "":
+		return nil, nil //nolint:nilnil // no resources is a valid result
+	case "-":
+		data, err = io.ReadAll(os.Stdin)
+	default:
+		data, err = os.ReadFile(path)
+	}
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	resources := &specResources{}
+	if err := json.Unmarshal(data, resources); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return resources, nil
+}
+
+// mergeResources overrides base with the fields specified in override, where block IO is replaced as a whole.
+// Device rules are kept as base. It returns nil if neither is specified.
+func mergeResources(base, override *specResources) *specResources {
+	if base == nil || override == nil {
+		return cmp.Or(override, base)
+	}
+
+	merged := *base
+
+	if override.Memory != nil {
+		memory := specMemory{}
+		if merged.Memory != nil {
+			memory = *merged.Memory
+		}
+
+		memory.Limit = cmp.Or(override.Memory.Limit, memory.Limit)
+		memory.Swap = cmp.Or(override.Memory.Swap, memory.Swap)
+		merged.Memory = &memory
+	}
+
+	if override.CPU != nil {
+		cpu := specCPU{}
+		if merged.CPU != nil {
+			cpu = *merged.CPU
+		}
+
+		cpu.Shares = cmp.Or(override.CPU.Shares, cpu.Shares)
+		cpu.Quota = cmp.Or(override.CPU.Quota, cpu.Quota)
+		cpu.Period = cmp.Or(override.CPU.Period, cpu.Period)
+		merged.CPU = &cpu
+	}
+
+	merged.Pids = cmp.Or(override.Pids, merged.Pids)
+	merged.BlockIO = cmp.Or(override.BlockIO, merged.BlockIO)
+
+	if override.Unified != nil {
+		merged.Unified = maps.Clone(base.Unified)
+		if merged.Unified == nil {
+			merged.Unified = map[string]string{}
+		}
+
+		maps.Copy(merged.Unified, override.Unified)
+	}
+
+	return &merged
+}
+
+// update applies resources to the cgroup as a whole. If writing a file fails, the files already written are restored.
+func (c *cgroup) update(resources *specResources) error {
+	files, err := cgroupFiles(resources)
+	if err != nil {
+		return err
+	}
+
+	// Lowering memory.max below the usage makes the kernel reclaim memory, or even kill processes.
+	if resources.Memory != nil && resources.Memory.Limit != nil && *resources.Memory.Limit > 0 {
+		usage, err := c.readUint("memory.current")
+		if err != nil {
+			return err
+		}
+
+		if uint64(*resources.Memory.Limit) < usage {
+			return errors.WithStack(fmt.Errorf("%w: %d < %d", ErrMemoryBelowUsage, *resources.Memory.Limit, usage))
+		}
+	}
+
+	previous := map[string]string{}
+
+	for _, file := range files {
+		if _, ok := previous[file.name]; ok {
+			continue
+		}
+
+		if previous[file.name], err = c.readFile(file.name); err != nil {
+			return err
+		}
+	}
+
+	for i, file := range files {
+		if err := c.writeFile(file.name, file.value); err != nil {
+			c.restore(files[:i+1], previous)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restore writes back the previous values of files on a best-effort basis, in the reverse order.
+func (c *cgroup) restore(files []cgroupFile, previous map[string]string) {
+	restored := map[string]bool{}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		file := files[i]
+		if restored[file.name] {
+			continue
+		}
+
+		restored[file.name] = true
+
+		if file.name != "io.max" {
+			_ = c.writeFile(file.name, previous[file.name])
+
+			continue
+		}
+
+		// io.max is read as a line per device with limits, and written per device.
+		limited := map[string]bool{}
+		for line := range strings.Lines(previous[file.name]) {
+			device, _, _ := strings.Cut(line, " ")
+			limited[device] = true
+		}
+
+		for _, written := range files[:i+1] {
+			if device, _, _ := strings.Cut(written.value, " "); written.name == file.name && !limited[device] {
+				_ = c.writeFile(file.name, device+" rbps=max wbps=max riops=max wiops=max")
+			}
+		}
+
+		for line := range strings.Lines(previous[file.name]) {
+			_ = c.writeFile(file.name, strings.TrimSpace(line))
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// marshalResources encodes the resources, to compare them regardless of their pointers.
+func marshalResources(t *testing.T, resources *specResources) string {
+	t.Helper()
+
+	data, err := json.Marshal(resources)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	return string(data)
+}
+
+func TestMergeResources(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		base     *specResources
+		override *specResources
+		want     *specResources
+	}{
+		{name: "nil", base: nil, override: nil, want: nil},
+		{name: "nil base", override: &specResources{Pids: &specPids{Limit: 10}}, want: &specResources{Pids: &specPids{Limit: 10}}},
+		{name: "nil override", base: &specResources{Pids: &specPids{Limit: 10}}, want: &specResources{Pids: &specPids{Limit: 10}}},
+		{
+			name:     "memory fields",
+			base:     &specResources{Memory: &specMemory{Limit: pointer[int64](1 << 20), Swap: pointer[int64](2 << 20)}},
+			override: &specResources{Memory: &specMemory{Limit: pointer[int64](-1)}},
+			want:     &specResources{Memory: &specMemory{Limit: pointer[int64](-1), Swap: pointer[int64](2 << 20)}},
+		},
+		{
+			name:     "memory without base",
+			base:     &specResources{Pids: &specPids{Limit: 10}},
+			override: &specResources{Memory: &specMemory{Swap: pointer[int64](1 << 20)}},
+			want:     &specResources{Pids: &specPids{Limit: 10}, Memory: &specMemory{Swap: pointer[int64](1 << 20)}},
+		},
+		{
+			name:     "cpu fields",
+			base:     &specResources{CPU: &specCPU{Shares: pointer[uint64](1024), Quota: pointer[int64](50000)}},
+			override: &specResources{CPU: &specCPU{Quota: pointer[int64](-1), Period: pointer[uint64](200000)}},
+			want:     &specResources{CPU: &specCPU{Shares: pointer[uint64](1024), Quota: pointer[int64](-1), Period: pointer[uint64](200000)}},
+		},
+		{
+			name: "pids and block io replaced",
+			base: &specResources{
+				Pids:    &specPids{Limit: 10},
+				BlockIO: &specBlockIO{ThrottleReadBpsDevice: []specThrottleDevice{{Major: 8, Rate: 1 << 20}}},
+			},
+			override: &specResources{
+				Pids:    &specPids{Limit: 20},
+				BlockIO: &specBlockIO{ThrottleWriteBpsDevice: []specThrottleDevice{{Major: 8, Rate: 2 << 20}}},
+			},
+			want: &specResources{
+				Pids:    &specPids{Limit: 20},
+				BlockIO: &specBlockIO{ThrottleWriteBpsDevice: []specThrottleDevice{{Major: 8, Rate: 2 << 20}}},
+			},
+		},
+		{
+			name:     "unified keys",
+			base:     &specResources{Unified: map[string]string{"pids.max": "10", "memory.high": "max"}},
+			override: &specResources{Unified: map[string]string{"pids.max": "20"}},
+			want:     &specResources{Unified: map[string]string{"pids.max": "20", "memory.high": "max"}},
+		},
+		{
+			name:     "unified without base",
+			base:     &specResources{Pids: &specPids{Limit: 10}},
+			override: &specResources{Unified: map[string]string{"pids.max": "20"}},
+			want:     &specResources{Pids: &specPids{Limit: 10}, Unified: map[string]string{"pids.max": "20"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			before := marshalResources(t, tt.base)
+
+			if got := mergeResources(tt.base, tt.override); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeResources() = %s, want %s", marshalResources(t, got), marshalResources(t, tt.want))
+			}
+
+			// The spec of the container is the base, which must be left as it is.
+			if after := marshalResources(t, tt.base); after != before {
+				t.Errorf("mergeResources() changed the base from %s to %s", before, after)
+			}
+		})
+	}
+}
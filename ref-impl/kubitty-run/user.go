@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	ErrInvalidUserID = errors.New("user or group ID must be a non-negative integer")
+	ErrSetgroupsDeny = errors.New("additional groups can't be set in a user namespace which denies setgroups(2)")
+)
+
+// userFlags holds --uid, --gid, --group-add and --umask of a command line.
+type userFlags struct {
+	user specUser
+}
+
+func registerUserFlags(flags *flag.FlagSet) *userFlags {
+	usrFlags := &userFlags{}
+
+	for _, target := range []struct {
+		name  string
+		usage string
+		set   func(id uint32)
+	}{
+		{name: "uid", usage: "user ID of the command, defaulting to root", set: func(id uint32) { usrFlags.user.UID = id }},
+		{name: "gid", usage: "group ID of the command, defaulting to root", set: func(id uint32) { usrFlags.user.GID = id }},
+		{
+			name: "group-add", usage: "additional group ID of the command (repeatable)",
+			set: func(id uint32) { usrFlags.user.AdditionalGids = append(usrFlags.user.AdditionalGids, id) },
+		},
+	} {
+		flags.Func(target.name, target.usage, func(value string) error {
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return errors.WithStack(ErrInvalidUserID)
+			}
+
+			target.set(uint32(id))
+
+			return nil
+		})
+	}
+
+	flags.Func("umask", "umask of the command in octal", func(value string) error {
+		umask, err := strconv.ParseUint(value, 8, 32)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		mask := uint32(umask)
+		usrFlags.user.Umask = &mask
+
+		return nil
+	})
+
+	return usrFlags
+}
+
+// setUser switches to the user of the process. The permitted capabilities are kept, so that applyCapabilities can set them.
+func setUser(user specUser) error {
+	// Linux resets it on execve(2), so it doesn't affect the command.
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	denied, err := setgroupsDenied()
+	if err != nil {
+		return err
+	}
+
+	// The groups of the runtime must not leak into the container, unless they can't be changed at all.
+	switch {
+	case !denied:
+		gids := make([]int, 0, len(user.AdditionalGids))
+		for _, gid := range user.AdditionalGids {
+			gids = append(gids, int(gid))
+		}
+
+		if err := syscall.Setgroups(gids); err != nil {
+			return errors.WithStack(err)
+		}
+	case len(user.AdditionalGids) > 0:
+		return errors.WithStack(ErrSetgroupsDeny)
+	}
+
+	// syscall package applies set*id(2) to all threads, unlike golang.org/x/sys/unix.
+	if err := syscall.Setresgid(int(user.GID), int(user.GID), int(user.GID)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := syscall.Setresuid(int(user.UID), int(user.UID), int(user.UID)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if user.Umask != nil {
+		unix.Umask(int(*user.Umask))
+	}
+
+	return nil
+}
+
+// setgroupsDenied reports whether the process is in a user namespace whose setgroups(2) is denied.
+func setgroupsDenied() (bool, error) {
+	data, err := os.ReadFile("/proc/self/setgroups")
+	if err != nil {
+		// The file doesn't exist if proc isn't mounted in the container.
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, errors.WithStack(err)
+	}
+
+	return strings.TrimSpace(string(data)) == "deny", nil
+}
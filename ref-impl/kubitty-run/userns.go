@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/k1LoW/errors"
+)
+
+const idMappingFields = 3
+
+var (
+	ErrInvalidIDMapping = errors.New(`ID mapping must be in the form of "CONTAINER_ID:HOST_ID:SIZE"`)
+	ErrNoIDMapping      = errors.New("user namespace requires both UID and GID mappings")
+)
+
+// rootless reports whether the runtime runs without root privileges, which makes a user namespace mandatory.
+func rootless() bool {
+	return os.Geteuid() != 0
+}
+
+// defaultIDMappings maps root in the container to the caller, which an unprivileged user can do without helpers.
+func defaultIDMappings() ([]specIDMapping, []specIDMapping) {
+	uidMappings := []specIDMapping{{ContainerID: 0, HostID: uint32(os.Geteuid()), Size: 1}}
+	gidMappings := []specIDMapping{{ContainerID: 0, HostID: uint32(os.Getegid()), Size: 1}}
+
+	return uidMappings, gidMappings
+}
+
+// idMappingFlags holds --uid-map and --gid-map of a command line.
+type idMappingFlags struct {
+	uid []specIDMapping
+	gid []specIDMapping
+}
+
+func registerIDMappingFlags(flags *flag.FlagSet) *idMappingFlags {
+	mapFlags := &idMappingFlags{}
+
+	for _, target := range []struct {
+		name     string
+		mappings *[]specIDMapping
+	}{
+		{name: "uid-map", mappings: &mapFlags.uid},
+		{name: "gid-map", mappings: &mapFlags.gid},
+	} {
+		flags.Func(target.name, `ID mapping of the user namespace in the form of "CONTAINER_ID:HOST_ID:SIZE" (repeatable)`,
+			func(value string) error {
+				mapping, err := parseIDMapping(value)
+				if err != nil {
+					return err
+				}
+
+				*target.mappings = append(*target.mappings, mapping)
+
+				return nil
+			})
+	}
+
+	return mapFlags
+}
+
+func parseIDMapping(value string) (specIDMapping, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) != idMappingFields {
+		return specIDMapping{}, errors.WithStack(ErrInvalidIDMapping)
+	}
+
+	ids := [idMappingFields]uint32{}
+
+	for i, field := range fields {
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return specIDMapping{}, errors.WithStack(err)
+		}
+
+		ids[i] = uint32(id)
+	}
+
+	return specIDMapping{ContainerID: ids[0], HostID: ids[1], Size: ids[2]}, nil
+}
+
+// fillIDMappings sets the default mappings to the spec if it has a user namespace without mappings.
+func fillIDMappings(linux *specLinux) {
+	if !hasNamespace(linux.Namespaces, "user") || len(linux.UIDMappings)+len(linux.GIDMappings) > 0 {
+		return
+	}
+
+	linux.UIDMappings, linux.GIDMappings = defaultIDMappings()
+}
+
+// writeIDMappings writes the mappings of the user namespace the process is in.
+// It must be done by a process outside the namespace, before the process does anything depending on its IDs.
+func writeIDMappings(pid int, linux *specLinux) error {
+	if len(linux.UIDMappings) == 0 || len(linux.GIDMappings) == 0 {
+		return errors.WithStack(ErrNoIDMapping)
+	}
+
+	uidHelper, gidHelper := "", ""
+
+	if rootless() {
+		// Without privileges, mappings other than the caller itself need the setuid helpers of shadow-utils.
+		uidHelper, _ = exec.LookPath("newuidmap")
+		gidHelper, _ = exec.LookPath("newgidmap")
+
+		if gidHelper == "" {
+			// An unprivileged process can write gid_map only after giving up setgroups(2),
+			// otherwise it could drop a group used to deny access.
+			if err := os.WriteFile(fmt.Sprintf("/proc/%d/setgroups", pid), []byte("deny"), 0); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	if err := writeIDMapping(pid, "gid_map", gidHelper, linux.GIDMappings); err != nil {
+		return err
+	}
+
+	return writeIDMapping(pid, "uid_map", uidHelper, linux.UIDMappings)
+}
+
+func writeIDMapping(pid int, file, helper string, mappings []specIDMapping) error {
+	if helper != "" {
+		args := []string{strconv.Itoa(pid)}
+		for _, mapping := range mappings {
+			args = append(args, strconv.FormatUint(uint64(mapping.ContainerID), 10),
+				strconv.FormatUint(uint64(mapping.HostID), 10), strconv.FormatUint(uint64(mapping.Size), 10))
+		}
+
+		if out, err := exec.Command(helper, args...).CombinedOutput(); err != nil {
+			return errors.WithStack(fmt.Errorf("%s: %w: %s", helper, err, out))
+		}
+
+		return nil
+	}
+
+	lines := []string{}
+	for _, mapping := range mappings {
+		lines = append(lines, fmt.Sprintf("%d %d %d", mapping.ContainerID, mapping.HostID, mapping.Size))
+	}
+
+	// The whole map has to be written at once.
+	if err := os.WriteFile(fmt.Sprintf("/proc/%d/%s", pid, file), []byte(strings.Join(lines, "\n")), 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// becomeRoot switches to root of the user namespace, whose IDs were mapped by the runtime.
+func becomeRoot() error {
+	// syscall package applies set*id(2) to all threads, unlike golang.org/x/sys/unix.
+	if err := syscall.Setresgid(0, 0, 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := syscall.Setresuid(0, 0, 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestParseIDMapping(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		value   string
+		want    specIDMapping
+		wantErr error
+	}{
+		{name: "single", value: "0:1000:1", want: specIDMapping{ContainerID: 0, HostID: 1000, Size: 1}},
+		{name: "range", value: "1:100000:65536", want: specIDMapping{ContainerID: 1, HostID: 100000, Size: 65536}},
+		{name: "maximum", value: "0:4294967295:1", want: specIDMapping{ContainerID: 0, HostID: 4294967295, Size: 1}},
+		{name: "empty", value: "", wantErr: ErrInvalidIDMapping},
+		{name: "too few fields", value: "0:1000", wantErr: ErrInvalidIDMapping},
+		{name: "too many fields", value: "0:1000:1:1", wantErr: ErrInvalidIDMapping},
+		{name: "empty field", value: "0::1", wantErr: strconv.ErrSyntax},
+		{name: "not a number", value: "root:1000:1", wantErr: strconv.ErrSyntax},
+		{name: "negative", value: "-1:1000:1", wantErr: strconv.ErrSyntax},
+		{name: "out of range", value: "0:4294967296:1", wantErr: strconv.ErrRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseIDMapping(tt.value)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("parseIDMapping(%q) error = %v, want %v", tt.value, err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Errorf("parseIDMapping(%q) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Package crilog reads and writes container logs in the format of the Kubernetes Container Runtime Interface.
+//
+// Each line of a log file is "<timestamp> <stream> <tag> <content>",
+// where the timestamp is in RFC 3339 with nanoseconds and the tag is "P" for a partial line or "F" for a full one.
+package crilog
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/k1LoW/errors"
+)
+
+// Stream is the standard stream an entry was written to.
+type Stream string
+
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+const (
+	tagPartial = "P"
+	tagFull    = "F"
+)
+
+const (
+	delimiter = ' '
+	eol       = '\n'
+)
+
+var ErrInvalidEntry = errors.New("invalid CRI log entry")
+
+// Entry is a line of a log file.
+type Entry struct {
+	Timestamp time.Time
+	Stream    Stream
+	// Partial means the content continues in the next entry of the same stream.
+	Partial bool
+	// Content doesn't include the trailing newline.
+	Content []byte
+}
+
+// AppendText appends the entry to b in the log format, including the trailing newline.
+func (e *Entry) AppendText(b []byte) ([]byte, error) {
+	if e.Stream != Stdout && e.Stream != Stderr {
+		return nil, errors.WithStack(ErrInvalidEntry)
+	}
+
+	tag := tagFull
+	if e.Partial {
+		tag = tagPartial
+	}
+
+	b = e.Timestamp.AppendFormat(b, time.RFC3339Nano)
+	b = append(b, delimiter)
+	b = append(b, e.Stream...)
+	b = append(b, delimiter)
+	b = append(b, tag...)
+	b = append(b, delimiter)
+	b = append(b, e.Content...)
+	b = append(b, eol)
+
+	return b, nil
+}
+
+// ParseEntry parses a line of a log file, with or without the trailing newline.
+func ParseEntry(line []byte) (*Entry, error) {
+	line = bytes.TrimSuffix(line, []byte{eol})
+
+	timestamp, rest, ok := bytes.Cut(line, []byte{delimiter})
+	if !ok {
+		return nil, errors.WithStack(ErrInvalidEntry)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, string(timestamp))
+	if err != nil {
+		return nil, errors.WithStack(fmt.Errorf("%w: %w", ErrInvalidEntry, err))
+	}
+
+	stream, rest, ok := bytes.Cut(rest, []byte{delimiter})
+	if !ok || (Stream(stream) != Stdout && Stream(stream) != Stderr) {
+		return nil, errors.WithStack(ErrInvalidEntry)
+	}
+
+	// An empty full line may lack the delimiter before the content.
+	tag, content, _ := bytes.Cut(rest, []byte{delimiter})
+	if string(tag) != tagPartial && string(tag) != tagFull {
+		return nil, errors.WithStack(ErrInvalidEntry)
+	}
+
+	return &Entry{
+		Timestamp: t,
+		Stream:    Stream(stream),
+		Partial:   string(tag) == tagPartial,
+		Content:   bytes.Clone(content),
+	}, nil
+}
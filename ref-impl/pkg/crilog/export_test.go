@@ -0,0 +1,8 @@
+package crilog
+
+import "time"
+
+// SetNow replaces the clock stamping the entries, so that the output is predictable.
+func (w *Writer) SetNow(now func() time.Time) {
+	w.now = now
+}
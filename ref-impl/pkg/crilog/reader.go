@@ -0,0 +1,60 @@
+package crilog
+
+import (
+	"bufio"
+	"io"
+	"time"
+
+	"github.com/k1LoW/errors"
+)
+
+// Reader reads entries from a log file which may still be growing.
+type Reader struct {
+	in *bufio.Reader
+	// since skips the entries written before it.
+	since time.Time
+	// pending holds the beginning of a line whose rest hasn't been written yet.
+	pending []byte
+}
+
+// NewReader returns a reader of the entries written at or after since. The zero time means all of them.
+func NewReader(in io.Reader, since time.Time) *Reader {
+	return &Reader{in: bufio.NewReader(in), since: since}
+}
+
+// Next returns the next entry, or io.EOF when no complete line is available yet.
+// Calling it again after io.EOF continues from where it stopped once the file grows.
+func (r *Reader) Next() (*Entry, error) {
+	for {
+		entry, err := r.next()
+		if err != nil || !entry.Timestamp.Before(r.since) {
+			return entry, err
+		}
+	}
+}
+
+func (r *Reader) next() (*Entry, error) {
+	line, err := r.in.ReadSlice(eol)
+
+	for errors.Is(err, bufio.ErrBufferFull) {
+		r.pending = append(r.pending, line...)
+		line, err = r.in.ReadSlice(eol)
+	}
+
+	if err != nil {
+		r.pending = append(r.pending, line...)
+
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	if len(r.pending) > 0 {
+		line = append(r.pending, line...)
+		r.pending = r.pending[:0]
+	}
+
+	return ParseEntry(line)
+}
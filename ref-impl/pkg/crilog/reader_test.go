@@ -0,0 +1,198 @@
+package crilog_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/crilog"
+)
+
+func TestParseEntry(t *testing.T) {
+	t.Parallel()
+
+	stamp := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	tests := []struct {
+		name    string
+		line    string
+		want    *crilog.Entry
+		wantErr bool
+	}{
+		{
+			name: "full",
+			line: "2024-01-02T03:04:05.000000006Z stdout F hello world\n",
+			want: &crilog.Entry{Timestamp: stamp, Stream: crilog.Stdout, Content: []byte("hello world")},
+		},
+		{
+			name: "partial without newline",
+			line: "2024-01-02T03:04:05.000000006Z stderr P part",
+			want: &crilog.Entry{Timestamp: stamp, Stream: crilog.Stderr, Partial: true, Content: []byte("part")},
+		},
+		{
+			name: "empty content without delimiter",
+			line: "2024-01-02T03:04:05.000000006Z stdout F\n",
+			want: &crilog.Entry{Timestamp: stamp, Stream: crilog.Stdout, Content: []byte{}},
+		},
+		{name: "invalid timestamp", line: "yesterday stdout F hello\n", wantErr: true},
+		{name: "unknown stream", line: "2024-01-02T03:04:05Z stdin F hello\n", wantErr: true},
+		{name: "unknown tag", line: "2024-01-02T03:04:05Z stdout X hello\n", wantErr: true},
+		{name: "missing stream", line: "2024-01-02T03:04:05Z\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := crilog.ParseEntry([]byte(tt.line))
+			if tt.wantErr {
+				if !errors.Is(err, crilog.ErrInvalidEntry) {
+					t.Errorf("ParseEntry() error = %v, want ErrInvalidEntry", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseEntry() error = %v", err)
+			}
+
+			if !got.Timestamp.Equal(tt.want.Timestamp) || got.Stream != tt.want.Stream || got.Partial != tt.want.Partial ||
+				!bytes.Equal(got.Content, tt.want.Content) {
+				t.Errorf("ParseEntry() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReaderRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	writer, out := newWriter(t)
+	stdout := writer.Stream(crilog.Stdout)
+	stderr := writer.Stream(crilog.Stderr)
+
+	// The long line doesn't fit in the buffer of the reader either.
+	long := strings.Repeat("x", crilog.MaxLineSize+1)
+
+	for _, write := range []struct {
+		stream io.Writer
+		data   string
+	}{
+		{stream: stdout, data: "first\n"},
+		{stream: stderr, data: long + "\n"},
+		{stream: stdout, data: "last\n"},
+	} {
+		if _, err := write.stream.Write([]byte(write.data)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	want := []struct {
+		stream  crilog.Stream
+		partial bool
+		content string
+	}{
+		{stream: crilog.Stdout, content: "first"},
+		{stream: crilog.Stderr, partial: true, content: long[:crilog.MaxLineSize]},
+		{stream: crilog.Stderr, content: "x"},
+		{stream: crilog.Stdout, content: "last"},
+	}
+
+	reader := crilog.NewReader(out, time.Time{})
+
+	for i, entry := range want {
+		got, err := reader.Next()
+		if err != nil {
+			t.Fatalf("Next() #%d error = %v", i, err)
+		}
+
+		if got.Stream != entry.stream || got.Partial != entry.partial || string(got.Content) != entry.content {
+			t.Errorf("Next() #%d = %s %t %d bytes, want %s %t %d bytes",
+				i, got.Stream, got.Partial, len(got.Content), entry.stream, entry.partial, len(entry.content))
+		}
+
+		if want := baseTime().Add(time.Duration(i) * time.Second); !got.Timestamp.Equal(want) {
+			t.Errorf("Next() #%d timestamp = %v, want %v", i, got.Timestamp, want)
+		}
+	}
+
+	if _, err := reader.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Next() at the end error = %v, want io.EOF", err)
+	}
+}
+
+func TestReaderGrowingFile(t *testing.T) {
+	t.Parallel()
+
+	file := &bytes.Buffer{}
+	reader := crilog.NewReader(file, time.Time{})
+
+	file.WriteString("2024-01-02T03:04:05Z stdout F hel")
+
+	if _, err := reader.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("Next() on an incomplete line error = %v, want io.EOF", err)
+	}
+
+	file.WriteString("lo\n")
+
+	entry, err := reader.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+
+	if string(entry.Content) != "hello" {
+		t.Errorf("Next() content = %q, want %q", entry.Content, "hello")
+	}
+}
+
+func TestReaderSince(t *testing.T) {
+	t.Parallel()
+
+	writer, out := newWriter(t)
+	stream := writer.Stream(crilog.Stdout)
+
+	if _, err := stream.Write([]byte("0\n1\n2\n3\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		since time.Time
+		want  string
+	}{
+		{name: "zero", since: time.Time{}, want: "0123"},
+		{name: "exact timestamp", since: baseTime().Add(2 * time.Second), want: "23"},
+		{name: "between timestamps", since: baseTime().Add(1500 * time.Millisecond), want: "23"},
+		{name: "after all", since: baseTime().Add(time.Hour), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reader := crilog.NewReader(bytes.NewReader(out.Bytes()), tt.since)
+			got := ""
+
+			for {
+				entry, err := reader.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				if err != nil {
+					t.Fatalf("Next() error = %v", err)
+				}
+
+				got += string(entry.Content)
+			}
+
+			if got != tt.want {
+				t.Errorf("contents = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
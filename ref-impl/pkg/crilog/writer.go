@@ -0,0 +1,118 @@
+package crilog
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/k1LoW/errors"
+)
+
+// MaxLineSize is the size of the content above which a line is split into partial entries, the same as the kubelet.
+const MaxLineSize = 16 * 1024
+
+// Writer writes entries of multiple streams to a single log file.
+type Writer struct {
+	mu  sync.Mutex
+	out io.Writer
+	buf []byte
+	now func() time.Time
+}
+
+func NewWriter(out io.Writer) *Writer {
+	return &Writer{out: out, now: time.Now}
+}
+
+// WriteEntry writes a single entry, so that entries from different streams don't interleave.
+func (w *Writer) WriteEntry(entry *Entry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	buf, err := entry.AppendText(w.buf[:0])
+	if err != nil {
+		return err
+	}
+
+	w.buf = buf
+
+	if _, err := w.out.Write(buf); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Stream returns a writer which turns the output of the stream into entries.
+// The caller must close it to flush the last line without a trailing newline.
+func (w *Writer) Stream(stream Stream) io.WriteCloser {
+	return &streamWriter{log: w, stream: stream}
+}
+
+type streamWriter struct {
+	log    *Writer
+	stream Stream
+	// line holds the content which hasn't reached either a newline or MaxLineSize yet.
+	line []byte
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	n := len(p)
+
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, eol)
+		if i < 0 {
+			s.line = append(s.line, p...)
+
+			return n, s.splitLongLine()
+		}
+
+		s.line = append(s.line, p[:i]...)
+		p = p[i+1:]
+
+		if err := s.splitLongLine(); err != nil {
+			return 0, err
+		}
+
+		if err := s.flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+// splitLongLine writes the pending line as partial entries while it's longer than MaxLineSize.
+func (s *streamWriter) splitLongLine() error {
+	for len(s.line) > MaxLineSize {
+		err := s.write(s.line[:MaxLineSize], true)
+		s.line = s.line[:copy(s.line, s.line[MaxLineSize:])]
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flush writes the pending line as a full entry.
+func (s *streamWriter) flush() error {
+	err := s.write(s.line, false)
+	s.line = s.line[:0]
+
+	return err
+}
+
+func (s *streamWriter) write(content []byte, partial bool) error {
+	return s.log.WriteEntry(&Entry{Timestamp: s.log.now(), Stream: s.stream, Partial: partial, Content: content})
+}
+
+// Close writes the last line of the stream, which lacks a trailing newline, as a full entry.
+func (s *streamWriter) Close() error {
+	if len(s.line) == 0 {
+		return nil
+	}
+
+	return s.flush()
+}
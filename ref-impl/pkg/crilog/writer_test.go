@@ -0,0 +1,174 @@
+package crilog_test
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/crilog"
+)
+
+// baseTime is the timestamp of the first entry written by newWriter, which advances a second for each entry.
+func baseTime() time.Time {
+	return time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+}
+
+func newWriter(t *testing.T) (*crilog.Writer, *bytes.Buffer) {
+	t.Helper()
+
+	out := &bytes.Buffer{}
+	writer := crilog.NewWriter(out)
+	now := baseTime()
+
+	writer.SetNow(func() time.Time {
+		stamp := now
+		now = now.Add(time.Second)
+
+		return stamp
+	})
+
+	return writer, out
+}
+
+func parseEntries(t *testing.T, out *bytes.Buffer) []*crilog.Entry {
+	t.Helper()
+
+	entries := []*crilog.Entry{}
+
+	for line := range strings.Lines(out.String()) {
+		entry, err := crilog.ParseEntry([]byte(line))
+		if err != nil {
+			t.Fatalf("ParseEntry(%q) error = %v", line, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestStreamSplitsLongLines(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		writes []string
+		// want is the lengths of the contents, negative for partial entries.
+		want []int
+	}{
+		{name: "short line", writes: []string{"abc\n"}, want: []int{3}},
+		{name: "at the limit", writes: []string{strings.Repeat("a", crilog.MaxLineSize) + "\n"}, want: []int{crilog.MaxLineSize}},
+		{
+			name:   "over the limit",
+			writes: []string{strings.Repeat("a", crilog.MaxLineSize+1) + "\n"},
+			want:   []int{-crilog.MaxLineSize, 1},
+		},
+		{
+			name:   "split across writes",
+			writes: []string{strings.Repeat("a", crilog.MaxLineSize-1), "bb", strings.Repeat("c", crilog.MaxLineSize) + "\nd\n"},
+			want:   []int{-crilog.MaxLineSize, -crilog.MaxLineSize, 1, 1},
+		},
+		{name: "empty lines", writes: []string{"\n\n"}, want: []int{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			writer, out := newWriter(t)
+			stream := writer.Stream(crilog.Stdout)
+
+			for _, data := range tt.writes {
+				if n, err := stream.Write([]byte(data)); err != nil || n != len(data) {
+					t.Fatalf("Write() = %d, %v, want %d, nil", n, err, len(data))
+				}
+			}
+
+			got := []int{}
+			for _, entry := range parseEntries(t, out) {
+				if entry.Partial {
+					got = append(got, -len(entry.Content))
+				} else {
+					got = append(got, len(entry.Content))
+				}
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamClose(t *testing.T) {
+	t.Parallel()
+
+	writer, out := newWriter(t)
+	stream := writer.Stream(crilog.Stdout)
+
+	if _, err := stream.Write([]byte("done\nlast")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if want := "2024-01-02T03:04:05.000000006Z stdout F done\n"; out.String() != want {
+		t.Fatalf("output before Close = %q, want %q", out.String(), want)
+	}
+
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	want := "2024-01-02T03:04:05.000000006Z stdout F done\n2024-01-02T03:04:06.000000006Z stdout F last\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+
+	// Nothing is left to flush.
+	if err := writer.Stream(crilog.Stderr).Close(); err != nil || out.String() != want {
+		t.Errorf("Close() of an empty stream wrote %q, %v", strings.TrimPrefix(out.String(), want), err)
+	}
+}
+
+func TestWriterStreams(t *testing.T) {
+	t.Parallel()
+
+	writer, out := newWriter(t)
+	stdout := writer.Stream(crilog.Stdout)
+	stderr := writer.Stream(crilog.Stderr)
+
+	for _, write := range []struct {
+		stream io.Writer
+		data   string
+	}{
+		{stream: stdout, data: "out "},
+		{stream: stderr, data: "err\n"},
+		{stream: stdout, data: "line\n"},
+	} {
+		if _, err := write.stream.Write([]byte(write.data)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	want := "2024-01-02T03:04:05.000000006Z stderr F err\n" +
+		"2024-01-02T03:04:06.000000006Z stdout F out line\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestWriteEntryRejectsUnknownStream(t *testing.T) {
+	t.Parallel()
+
+	writer, out := newWriter(t)
+
+	if err := writer.WriteEntry(&crilog.Entry{Stream: "stdin"}); err == nil {
+		t.Error("WriteEntry() succeeded with an unknown stream")
+	}
+
+	if out.Len() != 0 {
+		t.Errorf("output = %q, want nothing", out.String())
+	}
+}
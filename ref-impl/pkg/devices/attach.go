@@ -0,0 +1,134 @@
+package devices
+
+import (
+	"os"
+	"runtime"
+	"unsafe"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	license    = "Apache"
+	logBufSize = 64 * 1024
+	// logLevel makes the verifier explain why it rejects a program.
+	logLevel = 1
+)
+
+// progLoadAttr is the part of union bpf_attr used by BPF_PROG_LOAD.
+// The pointers are __aligned_u64, which is 64 bits wide even on 32-bit architectures.
+type progLoadAttr struct {
+	progType    uint32
+	insnCnt     uint32
+	insns       uint64
+	license     uint64
+	logLevel    uint32
+	logSize     uint32
+	logBuf      uint64
+	kernVersion uint32
+	progFlags   uint32
+}
+
+// progAttachAttr is the part of union bpf_attr used by BPF_PROG_ATTACH.
+type progAttachAttr struct {
+	targetFD    uint32
+	attachBPFFD uint32
+	attachType  uint32
+	attachFlags uint32
+}
+
+type verifierError struct {
+	err error
+	log string
+}
+
+func (e *verifierError) Error() string {
+	return e.err.Error() + ": " + e.log
+}
+
+func (e *verifierError) Unwrap() error {
+	return e.err
+}
+
+// Attach loads the program and attaches it to the cgroup.
+// The program stays attached until the cgroup is removed, alongside those attached by the ancestors.
+func Attach(cgroupDir *os.File, program Program) error {
+	prog, err := load(program)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(prog)
+
+	attr := progAttachAttr{
+		targetFD:    uint32(cgroupDir.Fd()),
+		attachBPFFD: uint32(prog),
+		attachType:  unix.BPF_CGROUP_DEVICE,
+		attachFlags: unix.BPF_F_ALLOW_MULTI,
+	}
+
+	if _, err := bpf(unix.BPF_PROG_ATTACH, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// load loads the program into the kernel, and returns its file descriptor.
+func load(program Program) (int, error) {
+	insns, err := program.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	licenseBytes := append([]byte(license), 0)
+
+	attr := progLoadAttr{
+		progType: unix.BPF_PROG_TYPE_CGROUP_DEVICE,
+		insnCnt:  uint32(len(program)),
+		insns:    pointer(insns),
+		license:  pointer(licenseBytes),
+	}
+
+	// The garbage collector doesn't see the pointers held as integers, so the buffers are kept alive until the kernel reads them.
+	defer runtime.KeepAlive(insns)
+	defer runtime.KeepAlive(licenseBytes)
+
+	fd, err := bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err == nil {
+		return fd, nil
+	}
+
+	if !errors.Is(err, unix.EINVAL) && !errors.Is(err, unix.EACCES) {
+		return 0, errors.WithStack(err)
+	}
+
+	// Load again with the log of the verifier only when it's needed, since collecting it slows the verifier down.
+	logBuf := make([]byte, logBufSize)
+	attr.logLevel = logLevel
+	attr.logSize = uint32(len(logBuf))
+	attr.logBuf = pointer(logBuf)
+
+	fd, err = bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(logBuf)
+
+	if err == nil {
+		return fd, nil
+	}
+
+	return 0, errors.WithStack(&verifierError{err: err, log: unix.ByteSliceToString(logBuf)})
+}
+
+// pointer returns the address of the buffer as __aligned_u64.
+func pointer(buf []byte) uint64 {
+	return uint64(uintptr(unsafe.Pointer(&buf[0])))
+}
+
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return 0, errno
+	}
+
+	return int(fd), nil
+}
@@ -0,0 +1,175 @@
+package devices
+
+import (
+	"math"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	ErrInvalidType   = errors.New("invalid device type")
+	ErrInvalidAccess = errors.New("invalid device access")
+	ErrInvalidNumber = errors.New("device number out of range")
+)
+
+const (
+	allowed = 1
+	denied  = 0
+)
+
+// Compile converts the rules into a BPF_PROG_TYPE_CGROUP_DEVICE program.
+// Accesses matching none of the rules are denied.
+func Compile(rules []Rule) (Program, error) {
+	program := Program{
+		loadWord(regType, offsetAccessType),
+		alu32(unix.BPF_AND, regType, typeMask),
+		loadWord(regAccess, offsetAccessType),
+		alu32(unix.BPF_RSH, regAccess, typeBits),
+		loadWord(regMajor, offsetMajor),
+		loadWord(regMinor, offsetMinor),
+	}
+
+	// The last rule wins, so the rules are checked from the last one, returning on the first match.
+	for i := len(rules) - 1; i >= 0; i-- {
+		block, err := compileRule(rules[i])
+		if err != nil {
+			return nil, err
+		}
+
+		program = append(program, block...)
+
+		// The verifier rejects unreachable instructions after a rule matching everything.
+		if len(block) == len(verdict(rules[i])) {
+			return program, nil
+		}
+	}
+
+	return append(program, movImm(regReturn, denied), exit()), nil
+}
+
+// compileRule returns the instructions which return the verdict of the rule if it matches,
+// or otherwise fall through to the next rule.
+func compileRule(rule Rule) (Program, error) {
+	conditions, err := ruleConditions(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		block Program
+		// jumps are the indexes of the conditions, which skip the rest of the block when they aren't met.
+		jumps []int
+	)
+
+	for _, condition := range conditions {
+		block = append(block, condition...)
+		jumps = append(jumps, len(block)-1)
+	}
+
+	block = append(block, verdict(rule)...)
+
+	for _, i := range jumps {
+		block[i].Off = int16(len(block) - 1 - i)
+	}
+
+	return block, nil
+}
+
+// ruleConditions returns the conditions for the rule to match, each of which ends with a jump to be pointed past the rule.
+func ruleConditions(rule Rule) ([]Program, error) {
+	conditions := []Program{}
+
+	switch rule.Type {
+	case TypeAll, "":
+	case TypeBlock:
+		conditions = append(conditions, Program{jumpImm(unix.BPF_JNE, regType, unix.BPF_DEVCG_DEV_BLOCK, 0)})
+	case TypeChar:
+		conditions = append(conditions, Program{jumpImm(unix.BPF_JNE, regType, unix.BPF_DEVCG_DEV_CHAR, 0)})
+	default:
+		return nil, errors.WithStack(ErrInvalidType)
+	}
+
+	access, err := accessMask(rule.Access)
+	if err != nil {
+		return nil, err
+	}
+
+	if condition := accessCondition(rule.Allow, access); condition != nil {
+		conditions = append(conditions, condition)
+	}
+
+	for _, number := range []struct {
+		reg   uint8
+		value *int64
+	}{
+		{reg: regMajor, value: rule.Major},
+		{reg: regMinor, value: rule.Minor},
+	} {
+		if number.value == nil {
+			continue
+		}
+
+		if *number.value < 0 || *number.value > math.MaxInt32 {
+			return nil, errors.WithStack(ErrInvalidNumber)
+		}
+
+		conditions = append(conditions, Program{jumpImm(unix.BPF_JNE, number.reg, int32(*number.value), 0)})
+	}
+
+	return conditions, nil
+}
+
+// accessCondition returns the condition on the access requested, or nil if the rule covers every access.
+func accessCondition(allow bool, access int32) Program {
+	switch {
+	case access == unix.BPF_DEVCG_ACC_MKNOD|unix.BPF_DEVCG_ACC_READ|unix.BPF_DEVCG_ACC_WRITE:
+		return nil
+	case allow:
+		// Every access requested must be allowed by the rule.
+		return Program{
+			movReg(regTmp, regAccess),
+			alu32(unix.BPF_AND, regTmp, access),
+			jumpReg(unix.BPF_JNE, regTmp, regAccess, 0),
+		}
+	default:
+		// Any access requested denied by the rule denies the whole request, like opening with O_RDWR.
+		return Program{
+			movReg(regTmp, regAccess),
+			alu32(unix.BPF_AND, regTmp, access),
+			jumpImm(unix.BPF_JEQ, regTmp, 0, 0),
+		}
+	}
+}
+
+func verdict(rule Rule) Program {
+	value := int32(denied)
+	if rule.Allow {
+		value = allowed
+	}
+
+	return Program{movImm(regReturn, value), exit()}
+}
+
+func accessMask(access string) (int32, error) {
+	if access == "" {
+		access = "rwm"
+	}
+
+	var mask int32
+
+	for _, c := range access {
+		switch c {
+		case 'r':
+			mask |= unix.BPF_DEVCG_ACC_READ
+		case 'w':
+			mask |= unix.BPF_DEVCG_ACC_WRITE
+		case 'm':
+			mask |= unix.BPF_DEVCG_ACC_MKNOD
+		default:
+			return 0, errors.WithStack(ErrInvalidAccess)
+		}
+	}
+
+	return mask, nil
+}
@@ -0,0 +1,263 @@
+package devices_test
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/devices"
+)
+
+// access is struct bpf_cgroup_dev_ctx, which the program inspects.
+type access struct {
+	typ   int32
+	flags int32
+	major int32
+	minor int32
+}
+
+func (a access) field(t *testing.T, off int16) uint64 {
+	t.Helper()
+
+	switch off {
+	case 0:
+		return uint64(uint32(a.flags<<16 | a.typ))
+	case 4:
+		return uint64(uint32(a.major))
+	case 8:
+		return uint64(uint32(a.minor))
+	default:
+		t.Fatalf("unexpected offset %d of the context", off)
+
+		return 0
+	}
+}
+
+// run interprets the program as the kernel does, and reports whether the access is allowed.
+func run(t *testing.T, program devices.Program, dev access) bool {
+	t.Helper()
+
+	const ctxReg = 1
+
+	var regs [11]uint64
+
+	for pc := 0; pc < len(program); pc++ {
+		insn := program[pc]
+
+		switch insn.Code {
+		case unix.BPF_LDX | unix.BPF_MEM | unix.BPF_W:
+			if insn.Src != ctxReg {
+				t.Fatalf("load from r%d at %d, which isn't the context", insn.Src, pc)
+			}
+
+			regs[insn.Dst] = dev.field(t, insn.Off)
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			regs[insn.Dst] = uint64(uint32(regs[insn.Dst]) & uint32(insn.Imm))
+		case unix.BPF_ALU | unix.BPF_RSH | unix.BPF_K:
+			regs[insn.Dst] = uint64(uint32(regs[insn.Dst]) >> insn.Imm)
+		case unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_X:
+			regs[insn.Dst] = regs[insn.Src]
+		case unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K:
+			regs[insn.Dst] = uint64(int64(insn.Imm))
+		case unix.BPF_JMP | unix.BPF_JNE | unix.BPF_K:
+			if regs[insn.Dst] != uint64(int64(insn.Imm)) {
+				pc += int(insn.Off)
+			}
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K:
+			if regs[insn.Dst] == uint64(int64(insn.Imm)) {
+				pc += int(insn.Off)
+			}
+		case unix.BPF_JMP | unix.BPF_JNE | unix.BPF_X:
+			if regs[insn.Dst] != regs[insn.Src] {
+				pc += int(insn.Off)
+			}
+		case unix.BPF_JMP | unix.BPF_EXIT:
+			return regs[0] == 1
+		default:
+			t.Fatalf("unexpected instruction %#x at %d", insn.Code, pc)
+		}
+	}
+
+	t.Fatal("program ran off the end without exiting")
+
+	return false
+}
+
+func compile(t *testing.T, rules []devices.Rule) devices.Program {
+	t.Helper()
+
+	program, err := devices.Compile(rules)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	if _, err := program.MarshalBinary(); err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+
+	return program
+}
+
+func number(n int64) *int64 {
+	return &n
+}
+
+func char(major, minor int32, flags int32) access {
+	return access{typ: unix.BPF_DEVCG_DEV_CHAR, flags: flags, major: major, minor: minor}
+}
+
+func block(major, minor int32, flags int32) access {
+	return access{typ: unix.BPF_DEVCG_DEV_BLOCK, flags: flags, major: major, minor: minor}
+}
+
+const (
+	read  = unix.BPF_DEVCG_ACC_READ
+	write = unix.BPF_DEVCG_ACC_WRITE
+	mknod = unix.BPF_DEVCG_ACC_MKNOD
+)
+
+func TestCompileWildcards(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		rule devices.Rule
+		dev  access
+		want bool
+	}{
+		{name: "all types", rule: devices.Rule{Allow: true, Type: devices.TypeAll}, dev: block(8, 0, read), want: true},
+		{name: "empty type", rule: devices.Rule{Allow: true}, dev: char(1, 3, read|write|mknod), want: true},
+		{name: "char matches char", rule: devices.Rule{Allow: true, Type: devices.TypeChar}, dev: char(1, 3, read), want: true},
+		{name: "char doesn't match block", rule: devices.Rule{Allow: true, Type: devices.TypeChar}, dev: block(1, 3, read), want: false},
+		{name: "block matches block", rule: devices.Rule{Allow: true, Type: devices.TypeBlock}, dev: block(8, 0, read), want: true},
+		{name: "block doesn't match char", rule: devices.Rule{Allow: true, Type: devices.TypeBlock}, dev: char(8, 0, read), want: false},
+		{
+			name: "any minor", rule: devices.Rule{Allow: true, Type: devices.TypeChar, Major: number(136)},
+			dev: char(136, 42, read), want: true,
+		},
+		{
+			name: "other major", rule: devices.Rule{Allow: true, Type: devices.TypeChar, Major: number(136)},
+			dev: char(137, 42, read), want: false,
+		},
+		{
+			name: "any major", rule: devices.Rule{Allow: true, Type: devices.TypeChar, Minor: number(3)},
+			dev: char(7, 3, read), want: true,
+		},
+		{
+			name: "other minor", rule: devices.Rule{Allow: true, Type: devices.TypeChar, Minor: number(3)},
+			dev: char(7, 4, read), want: false,
+		},
+		{
+			name: "exact device", rule: devices.Rule{Allow: true, Type: devices.TypeChar, Major: number(1), Minor: number(3)},
+			dev: char(1, 3, read), want: true,
+		},
+		{
+			name: "swapped numbers", rule: devices.Rule{Allow: true, Type: devices.TypeChar, Major: number(1), Minor: number(3)},
+			dev: char(3, 1, read), want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := run(t, compile(t, []devices.Rule{tt.rule}), tt.dev); got != tt.want {
+				t.Errorf("allowed = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileAccess(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		access string
+		flags  int32
+		want   bool
+	}{
+		{name: "read of rw", access: "rw", flags: read, want: true},
+		{name: "write of rw", access: "rw", flags: write, want: true},
+		{name: "read and write of rw", access: "rw", flags: read | write, want: true},
+		{name: "mknod of rw", access: "rw", flags: mknod, want: false},
+		{name: "read and mknod of rw", access: "rw", flags: read | mknod, want: false},
+		{name: "mknod of m", access: "m", flags: mknod, want: true},
+		{name: "read of m", access: "m", flags: read, want: false},
+		{name: "everything of empty", access: "", flags: read | write | mknod, want: true},
+		{name: "everything of rwm", access: "mwr", flags: read | write | mknod, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rule := devices.Rule{Allow: true, Type: devices.TypeChar, Major: number(1), Minor: number(3), Access: tt.access}
+			if got := run(t, compile(t, []devices.Rule{rule}), char(1, 3, tt.flags)); got != tt.want {
+				t.Errorf("allowed = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileOrder(t *testing.T) {
+	t.Parallel()
+
+	allowAll := devices.Rule{Allow: true, Type: devices.TypeAll}
+	denyNull := devices.Rule{Allow: false, Type: devices.TypeChar, Major: number(1), Minor: number(3)}
+	denyWrite := devices.Rule{Allow: false, Type: devices.TypeChar, Major: number(1), Minor: number(3), Access: "w"}
+
+	tests := []struct {
+		name  string
+		rules []devices.Rule
+		dev   access
+		want  bool
+	}{
+		{name: "no rules", rules: nil, dev: char(1, 3, read), want: false},
+		{name: "deny after allow", rules: []devices.Rule{allowAll, denyNull}, dev: char(1, 3, read), want: false},
+		{name: "deny after allow leaves others", rules: []devices.Rule{allowAll, denyNull}, dev: char(1, 5, read), want: true},
+		{name: "allow after deny", rules: []devices.Rule{denyNull, allowAll}, dev: char(1, 3, read), want: true},
+		{name: "partial deny after allow", rules: []devices.Rule{allowAll, denyWrite}, dev: char(1, 3, read), want: true},
+		{name: "partial deny covers the access", rules: []devices.Rule{allowAll, denyWrite}, dev: char(1, 3, read|write), want: false},
+		{name: "default null", rules: devices.DefaultRules(), dev: char(1, 3, read|write), want: true},
+		{name: "default pts", rules: devices.DefaultRules(), dev: char(136, 0, read|write), want: true},
+		{name: "default mknod", rules: devices.DefaultRules(), dev: block(8, 0, mknod), want: true},
+		{name: "default disk", rules: devices.DefaultRules(), dev: block(8, 0, read), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := run(t, compile(t, tt.rules), tt.dev); got != tt.want {
+				t.Errorf("allowed = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		rule    devices.Rule
+		wantErr error
+	}{
+		{name: "unknown type", rule: devices.Rule{Type: "x"}, wantErr: devices.ErrInvalidType},
+		{name: "unknown access", rule: devices.Rule{Access: "rx"}, wantErr: devices.ErrInvalidAccess},
+		{name: "negative major", rule: devices.Rule{Major: number(-1)}, wantErr: devices.ErrInvalidNumber},
+		{name: "too large minor", rule: devices.Rule{Minor: number(1 << 32)}, wantErr: devices.ErrInvalidNumber},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := devices.Compile([]devices.Rule{tt.rule}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Compile() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
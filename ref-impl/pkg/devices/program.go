@@ -0,0 +1,86 @@
+package devices
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/sys/unix"
+)
+
+// Registers of eBPF.
+const (
+	regReturn = 0
+	regCtx    = 1
+	regType   = 2
+	regAccess = 3
+	regMajor  = 4
+	regMinor  = 5
+	regTmp    = 1
+)
+
+// Offsets of the fields in struct bpf_cgroup_dev_ctx.
+const (
+	offsetAccessType = 0
+	offsetMajor      = 4
+	offsetMinor      = 8
+)
+
+const (
+	instructionSize = 8
+	typeBits        = 16
+	typeMask        = 1<<typeBits - 1
+)
+
+// Instruction is an eBPF instruction, struct bpf_insn.
+type Instruction struct {
+	Code uint8
+	Dst  uint8
+	Src  uint8
+	Off  int16
+	Imm  int32
+}
+
+// Program is an eBPF program to be loaded as BPF_PROG_TYPE_CGROUP_DEVICE.
+type Program []Instruction
+
+// MarshalBinary encodes the program in the byte order of the host, as the kernel expects.
+func (p Program) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, len(p)*instructionSize)
+
+	for _, ins := range p {
+		b = append(b, ins.Code, ins.Dst|ins.Src<<4)
+		b = binary.NativeEndian.AppendUint16(b, uint16(ins.Off))
+		b = binary.NativeEndian.AppendUint32(b, uint32(ins.Imm))
+	}
+
+	return b, nil
+}
+
+// loadWord loads a 32-bit field of the context.
+func loadWord(dst uint8, off int16) Instruction {
+	return Instruction{Code: unix.BPF_LDX | unix.BPF_MEM | unix.BPF_W, Dst: dst, Src: regCtx, Off: off}
+}
+
+func alu32(op uint8, dst uint8, imm int32) Instruction {
+	return Instruction{Code: unix.BPF_ALU | op | unix.BPF_K, Dst: dst, Imm: imm}
+}
+
+func movReg(dst, src uint8) Instruction {
+	return Instruction{Code: unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_X, Dst: dst, Src: src}
+}
+
+func movImm(dst uint8, imm int32) Instruction {
+	return Instruction{Code: unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K, Dst: dst, Imm: imm}
+}
+
+// jumpImm jumps off instructions ahead when the comparison of dst with imm holds.
+func jumpImm(op uint8, dst uint8, imm int32, off int16) Instruction {
+	return Instruction{Code: unix.BPF_JMP | op | unix.BPF_K, Dst: dst, Imm: imm, Off: off}
+}
+
+func jumpReg(op uint8, dst, src uint8, off int16) Instruction {
+	return Instruction{Code: unix.BPF_JMP | op | unix.BPF_X, Dst: dst, Src: src, Off: off}
+}
+
+func exit() Instruction {
+	return Instruction{Code: unix.BPF_JMP | unix.BPF_EXIT}
+}
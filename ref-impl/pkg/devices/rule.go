@@ -0,0 +1,49 @@
+// Package devices enforces device access rules on cgroup v2 with a BPF_PROG_TYPE_CGROUP_DEVICE program.
+package devices
+
+// Rule allows or denies access to devices, in the form of linux.resources.devices in the OCI runtime spec.
+// When several rules match an access, the last one wins.
+type Rule struct {
+	Allow bool `json:"allow"`
+	// Type is "a" for all devices, "b" for block devices or "c" for character devices. Empty means "a".
+	Type Type `json:"type,omitempty"`
+	// Major and Minor are wildcards if nil.
+	Major *int64 `json:"major,omitempty"`
+	Minor *int64 `json:"minor,omitempty"`
+	// Access is a combination of "r" for read, "w" for write and "m" for mknod(2). Empty means "rwm".
+	Access string `json:"access,omitempty"`
+}
+
+type Type string
+
+const (
+	TypeAll   Type = "a"
+	TypeBlock Type = "b"
+	TypeChar  Type = "c"
+)
+
+// DefaultRules returns the rules for the devices every container can use, the same as runc.
+func DefaultRules() []Rule {
+	return []Rule{
+		// mknod(2) is allowed for any device, since it can't be opened without the rules below.
+		{Allow: true, Type: TypeChar, Access: "m"},
+		{Allow: true, Type: TypeBlock, Access: "m"},
+		charDevice(1, 3), // /dev/null
+		charDevice(1, 5), // /dev/zero
+		charDevice(1, 7), // /dev/full
+		charDevice(5, 0), // /dev/tty
+		charDevice(1, 8), // /dev/random
+		charDevice(1, 9), // /dev/urandom
+		charDevice(5, 1), // /dev/console
+		charDevice(5, 2), // /dev/ptmx
+		{Allow: true, Type: TypeChar, Major: ptr(int64(136)), Access: "rwm"}, // /dev/pts/*
+	}
+}
+
+func charDevice(major, minor int64) Rule {
+	return Rule{Allow: true, Type: TypeChar, Major: ptr(major), Minor: ptr(minor), Access: "rwm"}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,37 @@
+package netlink
+
+import (
+	"net/netip"
+
+	"golang.org/x/sys/unix"
+)
+
+// AddAddress assigns an address to a link. The network of the prefix is routed to the link.
+func (c *Conn) AddAddress(index int, prefix netip.Prefix) error {
+	request, err := addressRequest(index, prefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.execute(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_EXCL, request)
+
+	return err
+}
+
+func addressRequest(index int, prefix netip.Prefix) ([]byte, error) {
+	addr := prefix.Addr().AsSlice()
+
+	return marshalMessage(
+		unix.IfAddrmsg{Family: family(prefix.Addr()), Prefixlen: uint8(prefix.Bits()), Index: uint32(index)},
+		attribute{typ: unix.IFA_LOCAL, value: addr},
+		attribute{typ: unix.IFA_ADDRESS, value: addr},
+	)
+}
+
+func family(addr netip.Addr) uint8 {
+	if addr.Is4() {
+		return unix.AF_INET
+	}
+
+	return unix.AF_INET6
+}
@@ -0,0 +1,51 @@
+package netlink_test
+
+import (
+	"bytes"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/netlink"
+)
+
+func TestAddressRequest(t *testing.T) {
+	t.Parallel()
+
+	ipv6 := netip.MustParseAddr("fd00::2").AsSlice()
+
+	tests := []struct {
+		name   string
+		prefix netip.Prefix
+		header unix.IfAddrmsg
+		attrs  []byte
+	}{
+		{
+			name:   "ipv4",
+			prefix: netip.MustParsePrefix("10.0.0.2/24"),
+			header: unix.IfAddrmsg{Family: unix.AF_INET, Prefixlen: 24, Index: 3},
+			attrs:  slices.Concat(rtattr(unix.IFA_LOCAL, 10, 0, 0, 2), rtattr(unix.IFA_ADDRESS, 10, 0, 0, 2)),
+		},
+		{
+			name:   "ipv6",
+			prefix: netip.MustParsePrefix("fd00::2/64"),
+			header: unix.IfAddrmsg{Family: unix.AF_INET6, Prefixlen: 64, Index: 3},
+			attrs:  slices.Concat(rtattr(unix.IFA_LOCAL, ipv6...), rtattr(unix.IFA_ADDRESS, ipv6...)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			want := append(fixedHeader(t, tt.header), tt.attrs...)
+
+			got, err := netlink.AddressRequest(3, tt.prefix)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("AddressRequest(%v) = %v, %v, want %v", tt.prefix, got, err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package netlink
+
+import (
+	"encoding/binary"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+var ErrTruncatedAttribute = errors.New("truncated netlink attribute")
+
+// attribute is a type-length-value entry following the fixed header of a message.
+type attribute struct {
+	typ   uint16
+	value []byte
+}
+
+func stringAttribute(typ uint16, value string) attribute {
+	// The kernel expects strings to be null-terminated.
+	return attribute{typ: typ, value: append([]byte(value), 0)}
+}
+
+func uint32Attribute(typ uint16, value uint32) attribute {
+	return attribute{typ: typ, value: binary.NativeEndian.AppendUint32(nil, value)}
+}
+
+func nestedAttribute(typ uint16, attrs ...attribute) attribute {
+	return attribute{typ: typ, value: marshalAttributes(attrs)}
+}
+
+// marshalAttributes encodes attributes, each of which is padded to the alignment.
+func marshalAttributes(attrs []attribute) []byte {
+	data := []byte{}
+
+	for _, attr := range attrs {
+		length := unix.SizeofRtAttr + len(attr.value)
+
+		data = binary.NativeEndian.AppendUint16(data, uint16(length))
+		data = binary.NativeEndian.AppendUint16(data, attr.typ)
+		data = append(data, attr.value...)
+		data = append(data, make([]byte, align(length)-length)...)
+	}
+
+	return data
+}
+
+// parseAttributes decodes attributes into a map by type. Nested attributes are left encoded.
+func parseAttributes(data []byte) (map[uint16][]byte, error) {
+	attrs := map[uint16][]byte{}
+
+	for len(data) > 0 {
+		header := unix.RtAttr{}
+		if _, err := binary.Decode(data, binary.NativeEndian, &header); err != nil {
+			return nil, errors.WithStack(ErrTruncatedAttribute)
+		}
+
+		length := int(header.Len)
+		if length < unix.SizeofRtAttr || length > len(data) {
+			return nil, errors.WithStack(ErrTruncatedAttribute)
+		}
+
+		// The type may carry flags, which are not a part of it.
+		attrs[header.Type&^(unix.NLA_F_NESTED|unix.NLA_F_NET_BYTEORDER)] = data[unix.SizeofRtAttr:length]
+		data = data[min(align(length), len(data)):]
+	}
+
+	return attrs, nil
+}
+
+// marshalMessage encodes the fixed header of a message followed by its attributes.
+func marshalMessage(header any, attrs ...attribute) ([]byte, error) {
+	data, err := binary.Append(nil, binary.NativeEndian, header)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return append(data, marshalAttributes(attrs)...), nil
+}
@@ -0,0 +1,143 @@
+package netlink_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/netlink"
+)
+
+// attrHeader encodes struct rtattr, which precedes the value of an attribute.
+func attrHeader(length, typ uint16) []byte {
+	data := binary.NativeEndian.AppendUint16(nil, length)
+
+	return binary.NativeEndian.AppendUint16(data, typ)
+}
+
+// rtattr encodes an attribute as the kernel expects, independently of the package, padding it with zeros to 4 bytes.
+func rtattr(typ uint16, value ...byte) []byte {
+	data := append(attrHeader(uint16(unix.SizeofRtAttr+len(value)), typ), value...)
+	for len(data)%unix.NLMSG_ALIGNTO != 0 {
+		data = append(data, 0)
+	}
+
+	return data
+}
+
+func TestMarshalAttributes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		attrs []netlink.Attribute
+		want  []byte
+	}{
+		{name: "none", attrs: nil, want: []byte{}},
+		{name: "empty value", attrs: []netlink.Attribute{{Type: 1}}, want: attrHeader(4, 1)},
+		{
+			name:  "aligned value",
+			attrs: []netlink.Attribute{{Type: 2, Value: []byte{1, 2, 3, 4}}},
+			want:  append(attrHeader(8, 2), 1, 2, 3, 4),
+		},
+		{
+			name:  "padded value",
+			attrs: []netlink.Attribute{{Type: 3, Value: []byte{'e', 't', 'h', '0', 0}}},
+			want:  append(attrHeader(9, 3), 'e', 't', 'h', '0', 0, 0, 0, 0),
+		},
+		{
+			name:  "padding between attributes",
+			attrs: []netlink.Attribute{{Type: 1, Value: []byte{0xff}}, {Type: 2, Value: []byte{0xee, 0xdd, 0xcc}}},
+			want:  bytes.Join([][]byte{attrHeader(5, 1), {0xff, 0, 0, 0}, attrHeader(7, 2), {0xee, 0xdd, 0xcc, 0}}, nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := netlink.MarshalAttributes(tt.attrs...); !bytes.Equal(got, tt.want) {
+				t.Errorf("MarshalAttributes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    map[uint16][]byte
+		wantErr bool
+	}{
+		{name: "none", data: nil, want: map[uint16][]byte{}},
+		{
+			name: "padded",
+			data: append(rtattr(1, 'l', 'o', 0), rtattr(2, 1, 2, 3, 4)...),
+			want: map[uint16][]byte{1: {'l', 'o', 0}, 2: {1, 2, 3, 4}},
+		},
+		// The kernel may omit the padding of the last attribute.
+		{name: "last unpadded", data: append(attrHeader(5, 1), 0xff), want: map[uint16][]byte{1: {0xff}}},
+		{
+			name: "flags masked",
+			data: append(rtattr(unix.NLA_F_NESTED|1, rtattr(2, 0xff)...), rtattr(unix.NLA_F_NET_BYTEORDER|3, 0, 1)...),
+			want: map[uint16][]byte{1: rtattr(2, 0xff), 3: {0, 1}},
+		},
+		{name: "later duplicate", data: append(rtattr(1, 1), rtattr(1, 2)...), want: map[uint16][]byte{1: {2}}},
+		{name: "truncated header", data: []byte{8, 0}, wantErr: true},
+		{name: "length below header", data: append(attrHeader(3, 1), 0, 0, 0, 0), wantErr: true},
+		{name: "oversized", data: append(attrHeader(12, 1), 1, 2, 3, 4), wantErr: true},
+		{name: "oversized after valid", data: append(rtattr(1, 1), append(attrHeader(9, 2), 1, 2, 3, 4)...), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := netlink.ParseAttributes(tt.data)
+			if tt.wantErr {
+				if !errors.Is(err, netlink.ErrTruncatedAttribute) {
+					t.Errorf("ParseAttributes() error = %v, want ErrTruncatedAttribute", err)
+				}
+
+				return
+			}
+
+			if err != nil || !maps.EqualFunc(got, tt.want, bytes.Equal) {
+				t.Errorf("ParseAttributes() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttributesRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	attrs := []netlink.Attribute{
+		{Type: unix.IFLA_IFNAME, Value: []byte("veth0\x00")},
+		{Type: unix.IFLA_MTU, Value: binary.NativeEndian.AppendUint32(nil, 1500)},
+		{Type: unix.IFLA_LINKINFO, Value: netlink.MarshalAttributes(netlink.Attribute{Type: unix.IFLA_INFO_KIND, Value: []byte("veth\x00")})},
+		{Type: unix.IFLA_ADDRESS},
+	}
+
+	got, err := netlink.ParseAttributes(netlink.MarshalAttributes(attrs...))
+	if err != nil {
+		t.Fatalf("ParseAttributes() error = %v", err)
+	}
+
+	if len(got) != len(attrs) {
+		t.Errorf("ParseAttributes() = %v, want %d attributes", got, len(attrs))
+	}
+
+	for _, attr := range attrs {
+		if value, ok := got[attr.Type]; !ok || !bytes.Equal(value, attr.Value) {
+			t.Errorf("attribute %d = %v, want %v", attr.Type, value, attr.Value)
+		}
+	}
+}
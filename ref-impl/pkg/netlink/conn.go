@@ -0,0 +1,167 @@
+// Package netlink is a minimal rtnetlink client to set up links, addresses and routes of network namespaces.
+package netlink
+
+import (
+	"encoding/binary"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+// receiveBufferSize is large enough for a message about a link, which is the largest one received.
+const receiveBufferSize = 32 * 1024
+
+var ErrTruncatedMessage = errors.New("truncated netlink message")
+
+// Conn is a NETLINK_ROUTE socket, which operates on the network namespace it's opened in.
+type Conn struct {
+	fd  int
+	seq uint32
+}
+
+// Dial opens a connection in the network namespace of the calling thread.
+func Dial() (*Conn, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+
+		return nil, errors.WithStack(err)
+	}
+
+	return &Conn{fd: fd}, nil
+}
+
+func (c *Conn) Close() error {
+	if err := unix.Close(c.fd); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// execute sends a request and waits for its acknowledgement, returning the payloads of the replies before it.
+func (c *Conn) execute(msgType, flags uint16, body []byte) ([][]byte, error) {
+	c.seq++
+
+	request, err := marshalRequest(msgType, flags, c.seq, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unix.Sendto(c.fd, request, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	replies := [][]byte{}
+
+	for {
+		// The replies refer to the buffer, so it can't be reused for the next receive.
+		buf := make([]byte, receiveBufferSize)
+
+		n, _, err := unix.Recvfrom(c.fd, buf, 0)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		received, done, err := parseReplies(buf[:n], c.seq)
+		if err != nil {
+			return nil, err
+		}
+
+		replies = append(replies, received...)
+
+		if done {
+			return replies, nil
+		}
+	}
+}
+
+// marshalRequest prepends the header of a request asking for the acknowledgement to body.
+func marshalRequest(msgType, flags uint16, seq uint32, body []byte) ([]byte, error) {
+	header := unix.NlMsghdr{
+		Len:   uint32(unix.SizeofNlMsghdr + len(body)),
+		Type:  msgType,
+		Flags: unix.NLM_F_REQUEST | unix.NLM_F_ACK | flags,
+		Seq:   seq,
+	}
+
+	request, err := binary.Append(nil, binary.NativeEndian, header)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return append(request, body...), nil
+}
+
+// parseReplies returns the payloads of the replies to the request seq in data, which is a datagram received.
+// done reports whether the acknowledgement or the end of the replies is found.
+func parseReplies(data []byte, seq uint32) ([][]byte, bool, error) {
+	replies := [][]byte{}
+
+	for len(data) > 0 {
+		header, payload, rest, err := parseMessage(data)
+		if err != nil {
+			return nil, false, err
+		}
+
+		data = rest
+
+		// Skip the replies to the requests given up by an error.
+		if header.Seq != seq {
+			continue
+		}
+
+		switch header.Type {
+		case unix.NLMSG_ERROR:
+			if err := parseError(payload); err != nil {
+				return nil, false, err
+			}
+
+			return replies, true, nil
+		case unix.NLMSG_DONE:
+			return replies, true, nil
+		default:
+			replies = append(replies, payload)
+		}
+	}
+
+	return replies, false, nil
+}
+
+// parseError decodes the payload of an error message, which is the acknowledgement when it carries no error.
+func parseError(payload []byte) error {
+	if len(payload) < unix.SizeofNlMsgerr {
+		return errors.WithStack(ErrTruncatedMessage)
+	}
+
+	if code := int32(binary.NativeEndian.Uint32(payload)); code != 0 {
+		return errors.WithStack(unix.Errno(-code))
+	}
+
+	return nil
+}
+
+// parseMessage splits the first message from data, returning its header, payload and the following messages.
+func parseMessage(data []byte) (unix.NlMsghdr, []byte, []byte, error) {
+	header := unix.NlMsghdr{}
+	if _, err := binary.Decode(data, binary.NativeEndian, &header); err != nil {
+		return header, nil, nil, errors.WithStack(ErrTruncatedMessage)
+	}
+
+	if header.Len < unix.SizeofNlMsghdr || int(header.Len) > len(data) {
+		return header, nil, nil, errors.WithStack(ErrTruncatedMessage)
+	}
+
+	next := min(align(int(header.Len)), len(data))
+
+	return header, data[unix.SizeofNlMsghdr:header.Len], data[next:], nil
+}
+
+// align rounds length up to the alignment of netlink messages and attributes, which are both 4 bytes.
+func align(length int) int {
+	return (length + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+}
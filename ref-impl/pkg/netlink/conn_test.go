@@ -0,0 +1,167 @@
+package netlink_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/netlink"
+)
+
+// messageHeader encodes struct nlmsghdr with the given length, which may differ from that of the payload.
+func messageHeader(length uint32, typ uint16, seq uint32) []byte {
+	data := binary.NativeEndian.AppendUint32(nil, length)
+	data = binary.NativeEndian.AppendUint16(data, typ)
+	data = binary.NativeEndian.AppendUint16(data, 0)
+	data = binary.NativeEndian.AppendUint32(data, seq)
+
+	return binary.NativeEndian.AppendUint32(data, 0)
+}
+
+// message encodes a message as the kernel sends it, padding it with zeros to 4 bytes.
+func message(typ uint16, seq uint32, payload ...byte) []byte {
+	data := append(messageHeader(uint32(unix.SizeofNlMsghdr+len(payload)), typ, seq), payload...)
+	for len(data)%unix.NLMSG_ALIGNTO != 0 {
+		data = append(data, 0)
+	}
+
+	return data
+}
+
+// errorMessage encodes the reply to the request seq, which is the acknowledgement if errno is 0.
+func errorMessage(seq uint32, errno unix.Errno) []byte {
+	// The error is followed by the header of the request.
+	payload := binary.NativeEndian.AppendUint32(nil, uint32(-int32(errno)))
+
+	return message(unix.NLMSG_ERROR, seq, append(payload, messageHeader(unix.SizeofNlMsghdr, unix.RTM_NEWLINK, seq)...)...)
+}
+
+func TestMarshalRequest(t *testing.T) {
+	t.Parallel()
+
+	got, err := netlink.MarshalRequest(unix.RTM_NEWLINK, unix.NLM_F_CREATE, 7, []byte{1, 2, 3, 4, 5})
+	if err != nil {
+		t.Fatalf("MarshalRequest() error = %v", err)
+	}
+
+	want := binary.NativeEndian.AppendUint32(nil, 21)
+	want = binary.NativeEndian.AppendUint16(want, unix.RTM_NEWLINK)
+	want = binary.NativeEndian.AppendUint16(want, unix.NLM_F_REQUEST|unix.NLM_F_ACK|unix.NLM_F_CREATE)
+	want = binary.NativeEndian.AppendUint32(want, 7)
+	// The port ID is left to the kernel, and the last message needs no padding.
+	want = append(binary.NativeEndian.AppendUint32(want, 0), 1, 2, 3, 4, 5)
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("MarshalRequest() = %v, want %v", got, want)
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		data        []byte
+		wantType    uint16
+		wantPayload []byte
+		wantRest    []byte
+		wantErr     bool
+	}{
+		{name: "empty payload", data: message(unix.NLMSG_DONE, 1), wantType: unix.NLMSG_DONE, wantPayload: []byte{}, wantRest: []byte{}},
+		{
+			name:        "padding before next",
+			data:        append(message(unix.RTM_NEWLINK, 1, 1, 2, 3, 4, 5), message(unix.NLMSG_DONE, 1)...),
+			wantType:    unix.RTM_NEWLINK,
+			wantPayload: []byte{1, 2, 3, 4, 5},
+			wantRest:    message(unix.NLMSG_DONE, 1),
+		},
+		{
+			name:        "last unpadded",
+			data:        append(messageHeader(unix.SizeofNlMsghdr+1, unix.RTM_NEWLINK, 1), 0xff),
+			wantType:    unix.RTM_NEWLINK,
+			wantPayload: []byte{0xff},
+			wantRest:    []byte{},
+		},
+		{name: "truncated header", data: messageHeader(unix.SizeofNlMsghdr, unix.NLMSG_DONE, 1)[:12], wantErr: true},
+		{name: "length below header", data: messageHeader(unix.SizeofNlMsghdr-1, unix.NLMSG_DONE, 1), wantErr: true},
+		{name: "oversized", data: append(messageHeader(unix.SizeofNlMsghdr+8, unix.RTM_NEWLINK, 1), 1, 2, 3, 4), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			header, payload, rest, err := netlink.ParseMessage(tt.data)
+			if tt.wantErr {
+				if !errors.Is(err, netlink.ErrTruncatedMessage) {
+					t.Errorf("ParseMessage() error = %v, want ErrTruncatedMessage", err)
+				}
+
+				return
+			}
+
+			if err != nil || header.Type != tt.wantType || !bytes.Equal(payload, tt.wantPayload) || !bytes.Equal(rest, tt.wantRest) {
+				t.Errorf("ParseMessage() = %+v, %v, %v, %v, want type %d, %v, %v", header, payload, rest, err, tt.wantType, tt.wantPayload, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestParseReplies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		data     []byte
+		want     [][]byte
+		wantDone bool
+		wantErr  error
+	}{
+		{name: "acknowledgement", data: errorMessage(2, 0), want: [][]byte{}, wantDone: true},
+		{
+			name:     "replies before acknowledgement",
+			data:     slices.Concat(message(unix.RTM_NEWLINK, 2, 1), message(unix.RTM_NEWLINK, 2, 2, 3), errorMessage(2, 0)),
+			want:     [][]byte{{1}, {2, 3}},
+			wantDone: true,
+		},
+		{
+			name:     "end of dump",
+			data:     slices.Concat(message(unix.RTM_NEWLINK, 2, 1), message(unix.NLMSG_DONE, 2)),
+			want:     [][]byte{{1}},
+			wantDone: true,
+		},
+		{name: "more to receive", data: message(unix.RTM_NEWLINK, 2, 1), want: [][]byte{{1}}},
+		{
+			name:     "other requests skipped",
+			data:     slices.Concat(errorMessage(1, unix.EEXIST), message(unix.RTM_NEWLINK, 1, 1), errorMessage(2, 0)),
+			want:     [][]byte{},
+			wantDone: true,
+		},
+		{name: "error", data: slices.Concat(message(unix.RTM_NEWLINK, 2, 1), errorMessage(2, unix.EEXIST)), wantErr: unix.EEXIST},
+		{name: "truncated error", data: message(unix.NLMSG_ERROR, 2, 0, 0, 0, 0), wantErr: netlink.ErrTruncatedMessage},
+		{name: "truncated message", data: append(message(unix.RTM_NEWLINK, 2, 1), 0, 0), wantErr: netlink.ErrTruncatedMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, done, err := netlink.ParseReplies(tt.data, 2)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParseReplies() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil || done != tt.wantDone || !slices.EqualFunc(got, tt.want, bytes.Equal) {
+				t.Errorf("ParseReplies() = %v, %t, %v, want %v, %t", got, done, err, tt.want, tt.wantDone)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package netlink
+
+import (
+	"net/netip"
+
+	"golang.org/x/sys/unix"
+)
+
+// Attribute is an attribute with its fields exported, so that the tests can encode any of them.
+type Attribute struct {
+	Type  uint16
+	Value []byte
+}
+
+func MarshalAttributes(attrs ...Attribute) []byte {
+	converted := make([]attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		converted = append(converted, attribute{typ: attr.Type, value: attr.Value})
+	}
+
+	return marshalAttributes(converted)
+}
+
+func ParseAttributes(data []byte) (map[uint16][]byte, error) {
+	return parseAttributes(data)
+}
+
+func MarshalRequest(msgType, flags uint16, seq uint32, body []byte) ([]byte, error) {
+	return marshalRequest(msgType, flags, seq, body)
+}
+
+func ParseMessage(data []byte) (unix.NlMsghdr, []byte, []byte, error) {
+	return parseMessage(data)
+}
+
+func ParseReplies(data []byte, seq uint32) ([][]byte, bool, error) {
+	return parseReplies(data, seq)
+}
+
+func VethRequest(veth Veth) ([]byte, error) {
+	return vethRequest(veth)
+}
+
+func AddressRequest(index int, prefix netip.Prefix) ([]byte, error) {
+	return addressRequest(index, prefix)
+}
+
+func RouteRequest(route Route) ([]byte, error) {
+	return routeRequest(route)
+}
@@ -0,0 +1,154 @@
+package netlink
+
+import (
+	"encoding/binary"
+	"os"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// vethInfoPeer is VETH_INFO_PEER of linux/veth.h, which golang.org/x/sys/unix lacks.
+	vethInfoPeer = 1
+
+	sizeofUint32 = 4
+)
+
+var ErrLinkNotFound = errors.New("link not found")
+
+// Link is a network interface.
+type Link struct {
+	Index int
+	Name  string
+	// Flags is a combination of IFF_* flags like unix.IFF_UP.
+	Flags uint32
+	MTU   uint32
+}
+
+// Veth is a pair of virtual ethernet devices, connected to each other.
+type Veth struct {
+	Name     string
+	PeerName string
+	// PeerNamespace is a file referring to the network namespace the peer is created in, like /proc/<pid>/ns/net.
+	// nil means the namespace of the connection.
+	PeerNamespace *os.File
+}
+
+// LinkByName looks up a link by its name.
+func (c *Conn) LinkByName(name string) (*Link, error) {
+	request, err := marshalMessage(unix.IfInfomsg{}, stringAttribute(unix.IFLA_IFNAME, name))
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := c.execute(unix.RTM_GETLINK, 0, request)
+	if err != nil {
+		if errors.Is(err, unix.ENODEV) {
+			return nil, errors.WithStack(ErrLinkNotFound)
+		}
+
+		return nil, err
+	}
+
+	if len(replies) == 0 {
+		return nil, errors.WithStack(ErrLinkNotFound)
+	}
+
+	return parseLink(replies[0])
+}
+
+func parseLink(data []byte) (*Link, error) {
+	info := unix.IfInfomsg{}
+
+	n, err := binary.Decode(data, binary.NativeEndian, &info)
+	if err != nil {
+		return nil, errors.WithStack(ErrTruncatedMessage)
+	}
+
+	attrs, err := parseAttributes(data[n:])
+	if err != nil {
+		return nil, err
+	}
+
+	link := &Link{Index: int(info.Index), Flags: info.Flags}
+
+	if name, ok := attrs[unix.IFLA_IFNAME]; ok {
+		link.Name = unix.ByteSliceToString(name)
+	}
+
+	if mtu, ok := attrs[unix.IFLA_MTU]; ok && len(mtu) >= sizeofUint32 {
+		link.MTU = binary.NativeEndian.Uint32(mtu)
+	}
+
+	return link, nil
+}
+
+// SetLinkUp brings a link up.
+func (c *Conn) SetLinkUp(index int) error {
+	request, err := marshalMessage(unix.IfInfomsg{Index: int32(index), Flags: unix.IFF_UP, Change: unix.IFF_UP})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.execute(unix.RTM_NEWLINK, 0, request)
+
+	return err
+}
+
+// SetLinkNamespace moves a link into the network namespace ns refers to.
+func (c *Conn) SetLinkNamespace(index int, ns *os.File) error {
+	request, err := marshalMessage(unix.IfInfomsg{Index: int32(index)}, uint32Attribute(unix.IFLA_NET_NS_FD, uint32(ns.Fd())))
+	if err != nil {
+		return err
+	}
+
+	_, err = c.execute(unix.RTM_NEWLINK, 0, request)
+
+	return err
+}
+
+// AddVeth creates a veth pair. Both ends are down until SetLinkUp is called.
+func (c *Conn) AddVeth(veth Veth) error {
+	request, err := vethRequest(veth)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.execute(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL, request)
+
+	return err
+}
+
+func vethRequest(veth Veth) ([]byte, error) {
+	peerAttrs := []attribute{stringAttribute(unix.IFLA_IFNAME, veth.PeerName)}
+	if veth.PeerNamespace != nil {
+		peerAttrs = append(peerAttrs, uint32Attribute(unix.IFLA_NET_NS_FD, uint32(veth.PeerNamespace.Fd())))
+	}
+
+	// The peer is described in the same form as a link of RTM_NEWLINK.
+	peer, err := marshalMessage(unix.IfInfomsg{}, peerAttrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalMessage(unix.IfInfomsg{},
+		stringAttribute(unix.IFLA_IFNAME, veth.Name),
+		nestedAttribute(unix.IFLA_LINKINFO,
+			stringAttribute(unix.IFLA_INFO_KIND, "veth"),
+			nestedAttribute(unix.IFLA_INFO_DATA, attribute{typ: vethInfoPeer, value: peer}),
+		),
+	)
+}
+
+// DeleteLink deletes a link. Deleting either end of a veth pair deletes both.
+func (c *Conn) DeleteLink(index int) error {
+	request, err := marshalMessage(unix.IfInfomsg{Index: int32(index)})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.execute(unix.RTM_DELLINK, 0, request)
+
+	return err
+}
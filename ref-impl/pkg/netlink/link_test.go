@@ -0,0 +1,73 @@
+package netlink_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/netlink"
+)
+
+// fixedHeader encodes the fixed header of a message, such as struct ifinfomsg.
+func fixedHeader(t *testing.T, header any) []byte {
+	t.Helper()
+
+	data, err := binary.Append(nil, binary.NativeEndian, header)
+	if err != nil {
+		t.Fatalf("binary.Append() error = %v", err)
+	}
+
+	return data
+}
+
+func TestVethRequest(t *testing.T) {
+	t.Parallel()
+
+	ns, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("os.Open() error = %v", err)
+	}
+	// The subtests run after the test returns, so the file is closed when they finish.
+	t.Cleanup(func() { ns.Close() }) //nolint:errcheck // closing /dev/null can't fail
+
+	fd := binary.NativeEndian.AppendUint32(nil, uint32(ns.Fd()))
+
+	tests := []struct {
+		name string
+		veth netlink.Veth
+		peer []byte
+	}{
+		{
+			name: "peer in the same namespace",
+			veth: netlink.Veth{Name: "veth0", PeerName: "eth0"},
+			peer: rtattr(unix.IFLA_IFNAME, 'e', 't', 'h', '0', 0),
+		},
+		{
+			name: "peer in another namespace",
+			veth: netlink.Veth{Name: "veth0", PeerName: "eth0", PeerNamespace: ns},
+			peer: slices.Concat(rtattr(unix.IFLA_IFNAME, 'e', 't', 'h', '0', 0), rtattr(unix.IFLA_NET_NS_FD, fd...)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The peer is nested as a link of its own, in IFLA_LINKINFO and IFLA_INFO_DATA.
+			peer := append(fixedHeader(t, unix.IfInfomsg{}), tt.peer...)
+			linkInfo := slices.Concat(rtattr(unix.IFLA_INFO_KIND, 'v', 'e', 't', 'h', 0), rtattr(unix.IFLA_INFO_DATA, rtattr(1, peer...)...))
+			want := slices.Concat(
+				fixedHeader(t, unix.IfInfomsg{}), rtattr(unix.IFLA_IFNAME, 'v', 'e', 't', 'h', '0', 0), rtattr(unix.IFLA_LINKINFO, linkInfo...),
+			)
+
+			got, err := netlink.VethRequest(tt.veth)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("VethRequest() = %v, %v, want %v", got, err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package netlink
+
+import (
+	"net/netip"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+var ErrInvalidRoute = errors.New("route needs a valid destination or gateway")
+
+// Route is an entry of the main routing table.
+type Route struct {
+	// Destination is the network the route leads to. The zero value means the default route.
+	Destination netip.Prefix
+	// Gateway is the next hop. The zero value means the destination is directly reachable through the link.
+	Gateway netip.Addr
+	// LinkIndex is the index of the outgoing link. 0 means the kernel chooses one from the gateway.
+	LinkIndex int
+}
+
+// AddRoute adds a route to the main routing table.
+func (c *Conn) AddRoute(route Route) error {
+	request, err := routeRequest(route)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.execute(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_EXCL, request)
+
+	return err
+}
+
+func routeRequest(route Route) ([]byte, error) {
+	var (
+		addr  netip.Addr
+		attrs []attribute
+	)
+
+	switch {
+	case route.Destination.IsValid():
+		addr = route.Destination.Addr()
+	case route.Gateway.IsValid():
+		addr = route.Gateway
+	default:
+		return nil, errors.WithStack(ErrInvalidRoute)
+	}
+
+	header := unix.RtMsg{
+		Family:   family(addr),
+		Table:    unix.RT_TABLE_MAIN,
+		Protocol: unix.RTPROT_BOOT,
+		Scope:    unix.RT_SCOPE_LINK,
+		Type:     unix.RTN_UNICAST,
+	}
+
+	if route.Destination.IsValid() && route.Destination.Bits() > 0 {
+		header.Dst_len = uint8(route.Destination.Bits())
+		attrs = append(attrs, attribute{typ: unix.RTA_DST, value: route.Destination.Masked().Addr().AsSlice()})
+	}
+
+	// A route through a gateway reaches beyond the link.
+	if route.Gateway.IsValid() {
+		header.Scope = unix.RT_SCOPE_UNIVERSE
+		attrs = append(attrs, attribute{typ: unix.RTA_GATEWAY, value: route.Gateway.AsSlice()})
+	}
+
+	if route.LinkIndex > 0 {
+		attrs = append(attrs, uint32Attribute(unix.RTA_OIF, uint32(route.LinkIndex)))
+	}
+
+	return marshalMessage(header, attrs...)
+}
@@ -0,0 +1,72 @@
+package netlink_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/netlink"
+)
+
+func TestRouteRequest(t *testing.T) {
+	t.Parallel()
+
+	oif := rtattr(unix.RTA_OIF, binary.NativeEndian.AppendUint32(nil, 3)...)
+	header := unix.RtMsg{
+		Family:   unix.AF_INET,
+		Table:    unix.RT_TABLE_MAIN,
+		Protocol: unix.RTPROT_BOOT,
+		Scope:    unix.RT_SCOPE_UNIVERSE,
+		Type:     unix.RTN_UNICAST,
+	}
+	link := header
+	link.Scope = unix.RT_SCOPE_LINK
+	link.Dst_len = 24
+
+	tests := []struct {
+		name    string
+		route   netlink.Route
+		header  unix.RtMsg
+		attrs   []byte
+		wantErr bool
+	}{
+		{
+			name:   "default",
+			route:  netlink.Route{Gateway: netip.MustParseAddr("10.0.0.1"), LinkIndex: 3},
+			header: header,
+			attrs:  slices.Concat(rtattr(unix.RTA_GATEWAY, 10, 0, 0, 1), oif),
+		},
+		{
+			name:   "directly reachable",
+			route:  netlink.Route{Destination: netip.MustParsePrefix("10.0.1.5/24"), LinkIndex: 3},
+			header: link,
+			attrs:  slices.Concat(rtattr(unix.RTA_DST, 10, 0, 1, 0), oif),
+		},
+		{name: "invalid", route: netlink.Route{LinkIndex: 3}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := netlink.RouteRequest(tt.route)
+			if tt.wantErr {
+				if !errors.Is(err, netlink.ErrInvalidRoute) {
+					t.Errorf("RouteRequest() error = %v, want ErrInvalidRoute", err)
+				}
+
+				return
+			}
+
+			want := append(fixedHeader(t, tt.header), tt.attrs...)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("RouteRequest() = %v, %v, want %v", got, err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package seccomp
+
+import "golang.org/x/sys/unix"
+
+const (
+	nativeArch     = unix.AUDIT_ARCH_X86_64
+	nativeArchName = "SCMP_ARCH_X86_64"
+	// x32SyscallBit marks syscalls of the x32 ABI, which share the architecture with x86-64.
+	x32SyscallBit = 0x40000000
+)
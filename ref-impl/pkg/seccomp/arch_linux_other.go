@@ -0,0 +1,14 @@
+//go:build linux && !amd64 && !arm64
+
+package seccomp
+
+const (
+	// nativeArch is unknown, so Compile always fails.
+	nativeArch     = 0
+	nativeArchName = ""
+	x32SyscallBit  = 0
+)
+
+func syscallNumbers() map[string]uint32 {
+	return map[string]uint32{}
+}
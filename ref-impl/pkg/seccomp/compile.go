@@ -0,0 +1,298 @@
+package seccomp
+
+//go:generate go run ./internal/mksyscalls amd64 arm64
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Offsets of the fields in struct seccomp_data.
+const (
+	offsetNr   = 0
+	offsetArch = 4
+	offsetArgs = 16
+
+	argSize = 8
+	maxArgs = 6
+	// maxJump is the farthest a conditional jump of classic BPF can reach.
+	maxJump = math.MaxUint8
+
+	wordBits = 32
+)
+
+var (
+	ErrUnsupportedArch     = errors.New("seccomp is not supported on this architecture")
+	ErrUnsupportedAction   = errors.New("unsupported seccomp action")
+	ErrUnsupportedOperator = errors.New("unsupported seccomp operator")
+	ErrInvalidArgIndex     = errors.New("seccomp argument index out of range")
+	ErrRuleTooLarge        = errors.New("seccomp rule has too many conditions")
+	ErrForeignArch         = errors.New("seccomp profile for other architectures than the native one is not supported")
+)
+
+// jumpTarget is a symbolic destination of a conditional jump inside a rule, resolved on assembling.
+type jumpTarget int
+
+const (
+	// targetNext continues to the next instruction.
+	targetNext jumpTarget = iota
+	// targetPass goes to the instruction after the current condition.
+	targetPass
+	// targetFail skips the rest of the rule.
+	targetFail
+)
+
+type instruction struct {
+	code   uint16
+	k      uint32
+	jt, jf jumpTarget
+}
+
+// Compile converts the profile into a classic BPF program for SECCOMP_SET_MODE_FILTER.
+// Syscalls unknown to the architecture are ignored, so that a profile can be shared among architectures.
+// Only the syscall numbers of the native architecture are known, so the other ones are always killed
+// and a profile listing any of them in Architectures is rejected.
+func Compile(profile *Profile) ([]unix.SockFilter, error) {
+	if nativeArch == 0 {
+		return nil, errors.WithStack(ErrUnsupportedArch)
+	}
+
+	for _, arch := range profile.Architectures {
+		if arch != nativeArchName {
+			return nil, errors.WithStack(fmt.Errorf("%w: %s", ErrForeignArch, arch))
+		}
+	}
+
+	defaultRet, err := actionValue(profile.DefaultAction, profile.DefaultErrnoRet)
+	if err != nil {
+		return nil, err
+	}
+
+	program := []unix.SockFilter{
+		// Syscall numbers differ among architectures, so a foreign architecture must not pass through the rules.
+		loadAbs(offsetArch),
+		jump(unix.BPF_JEQ, nativeArch, 1, 0),
+		ret(unix.SECCOMP_RET_KILL_PROCESS),
+		loadAbs(offsetNr),
+	}
+
+	if x32SyscallBit != 0 {
+		program = append(program,
+			jump(unix.BPF_JGE, x32SyscallBit, 0, 1),
+			ret(unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS)),
+		)
+	}
+
+	numbers := syscallNumbers()
+
+	for _, rule := range profile.Syscalls {
+		for _, name := range rule.Names {
+			nr, ok := numbers[name]
+			if !ok {
+				continue
+			}
+
+			block, err := compileRule(nr, rule)
+			if err != nil {
+				return nil, err
+			}
+
+			program = append(program, block...)
+		}
+	}
+
+	return append(program, ret(defaultRet)), nil
+}
+
+// compileRule returns the instructions that return the action of the rule if the syscall and its arguments match,
+// and otherwise fall through with the syscall number loaded.
+func compileRule(nr uint32, rule Syscall) ([]unix.SockFilter, error) {
+	action, err := actionValue(rule.Action, rule.ErrnoRet)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := [][]instruction{{{code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, k: nr, jt: targetNext, jf: targetFail}}}
+
+	for _, arg := range rule.Args {
+		condition, err := compileArg(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	if len(rule.Args) > 0 {
+		// Argument checks overwrote the accumulator, so restore the syscall number for the following rules.
+		conditions = append(conditions,
+			[]instruction{{code: unix.BPF_RET | unix.BPF_K, k: action}},
+			[]instruction{{code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, k: offsetNr}},
+		)
+	} else {
+		conditions = append(conditions, []instruction{{code: unix.BPF_RET | unix.BPF_K, k: action}})
+	}
+
+	return assemble(conditions, len(rule.Args) > 0)
+}
+
+// assemble resolves the jump targets of the conditions.
+// When reload is true, the last condition is the reload of the syscall number, which is the destination on failure.
+func assemble(conditions [][]instruction, reload bool) ([]unix.SockFilter, error) {
+	total := 0
+	for _, condition := range conditions {
+		total += len(condition)
+	}
+
+	failIndex := total
+	if reload {
+		failIndex = total - 1
+	}
+
+	program := make([]unix.SockFilter, 0, total)
+
+	for _, condition := range conditions {
+		passIndex := len(program) + len(condition)
+
+		for _, insn := range condition {
+			index := len(program)
+
+			jt, err := resolveJump(insn.jt, index, passIndex, failIndex)
+			if err != nil {
+				return nil, err
+			}
+
+			jf, err := resolveJump(insn.jf, index, passIndex, failIndex)
+			if err != nil {
+				return nil, err
+			}
+
+			program = append(program, unix.SockFilter{Code: insn.code, Jt: jt, Jf: jf, K: insn.k})
+		}
+	}
+
+	return program, nil
+}
+
+func resolveJump(target jumpTarget, index, passIndex, failIndex int) (uint8, error) {
+	var offset int
+
+	switch target {
+	case targetNext:
+		return 0, nil
+	case targetPass:
+		offset = passIndex - index - 1
+	case targetFail:
+		offset = failIndex - index - 1
+	}
+
+	if offset > maxJump {
+		return 0, errors.WithStack(ErrRuleTooLarge)
+	}
+
+	return uint8(offset), nil
+}
+
+// compileArg compares a 64 bit argument with two 32 bit words, since classic BPF has only a 32 bit accumulator.
+func compileArg(arg Arg) ([]instruction, error) {
+	if arg.Index >= maxArgs {
+		return nil, errors.WithStack(ErrInvalidArgIndex)
+	}
+
+	// seccomp_data is in the native endianness, and both supported architectures are little endian.
+	low := uint32(offsetArgs + argSize*arg.Index)
+	high := low + argSize/2
+	valueHigh, valueLow := uint32(arg.Value>>wordBits), uint32(arg.Value)
+
+	loadHigh := instruction{code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, k: high}
+	loadLow := instruction{code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, k: low}
+	jmp := func(op uint16, k uint32, jt, jf jumpTarget) instruction {
+		return instruction{code: unix.BPF_JMP | op | unix.BPF_K, k: k, jt: jt, jf: jf}
+	}
+
+	switch arg.Op {
+	case OpEqualTo:
+		return []instruction{
+			loadHigh, jmp(unix.BPF_JEQ, valueHigh, targetNext, targetFail),
+			loadLow, jmp(unix.BPF_JEQ, valueLow, targetPass, targetFail),
+		}, nil
+	case OpNotEqual:
+		return []instruction{
+			loadHigh, jmp(unix.BPF_JEQ, valueHigh, targetNext, targetPass),
+			loadLow, jmp(unix.BPF_JEQ, valueLow, targetFail, targetPass),
+		}, nil
+	case OpGreaterThan:
+		return []instruction{
+			loadHigh, jmp(unix.BPF_JGT, valueHigh, targetPass, targetNext), jmp(unix.BPF_JEQ, valueHigh, targetNext, targetFail),
+			loadLow, jmp(unix.BPF_JGT, valueLow, targetPass, targetFail),
+		}, nil
+	case OpGreaterEqual:
+		return []instruction{
+			loadHigh, jmp(unix.BPF_JGT, valueHigh, targetPass, targetNext), jmp(unix.BPF_JEQ, valueHigh, targetNext, targetFail),
+			loadLow, jmp(unix.BPF_JGE, valueLow, targetPass, targetFail),
+		}, nil
+	case OpLessThan:
+		return []instruction{
+			loadHigh, jmp(unix.BPF_JGE, valueHigh, targetNext, targetPass), jmp(unix.BPF_JGT, valueHigh, targetFail, targetNext),
+			loadLow, jmp(unix.BPF_JGE, valueLow, targetFail, targetPass),
+		}, nil
+	case OpLessEqual:
+		return []instruction{
+			loadHigh, jmp(unix.BPF_JGE, valueHigh, targetNext, targetPass), jmp(unix.BPF_JGT, valueHigh, targetFail, targetNext),
+			loadLow, jmp(unix.BPF_JGT, valueLow, targetFail, targetPass),
+		}, nil
+	case OpMaskedEqual:
+		return []instruction{
+			loadHigh, {code: unix.BPF_ALU | unix.BPF_AND | unix.BPF_K, k: valueHigh},
+			jmp(unix.BPF_JEQ, uint32(arg.ValueTwo>>wordBits), targetNext, targetFail),
+			loadLow, {code: unix.BPF_ALU | unix.BPF_AND | unix.BPF_K, k: valueLow},
+			jmp(unix.BPF_JEQ, uint32(arg.ValueTwo), targetPass, targetFail),
+		}, nil
+	default:
+		return nil, errors.WithStack(ErrUnsupportedOperator)
+	}
+}
+
+func actionValue(action Action, errnoRet *uint) (uint32, error) {
+	data := func(fallback unix.Errno) uint32 {
+		if errnoRet != nil {
+			return uint32(*errnoRet) & unix.SECCOMP_RET_DATA
+		}
+
+		return uint32(fallback)
+	}
+
+	switch action {
+	case ActKill, ActKillThread:
+		return unix.SECCOMP_RET_KILL_THREAD, nil
+	case ActKillProcess:
+		return unix.SECCOMP_RET_KILL_PROCESS, nil
+	case ActTrap:
+		return unix.SECCOMP_RET_TRAP, nil
+	case ActErrno:
+		return unix.SECCOMP_RET_ERRNO | data(unix.EPERM), nil
+	case ActTrace:
+		return unix.SECCOMP_RET_TRACE | data(0), nil
+	case ActAllow:
+		return unix.SECCOMP_RET_ALLOW, nil
+	case ActLog:
+		return unix.SECCOMP_RET_LOG, nil
+	default:
+		return 0, errors.WithStack(ErrUnsupportedAction)
+	}
+}
+
+func loadAbs(offset uint32) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: offset}
+}
+
+func jump(op uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_JMP | op | unix.BPF_K, Jt: jt, Jf: jf, K: k}
+}
+
+func ret(k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: k}
+}
@@ -0,0 +1,418 @@
+package seccomp_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/logica0419/coding-kubernetes/ref-impl/pkg/seccomp"
+)
+
+// seccompData is struct seccomp_data, which the filter inspects.
+type seccompData struct {
+	nr   uint32
+	arch uint32
+	args [6]uint64
+}
+
+func (d seccompData) marshal() []byte {
+	data := binary.NativeEndian.AppendUint32(nil, d.nr)
+	data = binary.NativeEndian.AppendUint32(data, d.arch)
+	// instruction_pointer is never inspected.
+	data = binary.NativeEndian.AppendUint64(data, 0)
+
+	for _, arg := range d.args {
+		data = binary.NativeEndian.AppendUint64(data, arg)
+	}
+
+	return data
+}
+
+// run interprets the program as the kernel does, and returns the value of the return instruction reached.
+func run(t *testing.T, program []unix.SockFilter, data seccompData) uint32 {
+	t.Helper()
+
+	input := data.marshal()
+
+	var acc uint32
+
+	for pc := 0; pc < len(program); pc++ {
+		insn := program[pc]
+
+		switch insn.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = binary.NativeEndian.Uint32(input[insn.K:])
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			acc &= insn.K
+		case unix.BPF_RET | unix.BPF_K:
+			return insn.K
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K:
+			pc += branch(acc == insn.K, insn)
+		case unix.BPF_JMP | unix.BPF_JGT | unix.BPF_K:
+			pc += branch(acc > insn.K, insn)
+		case unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			pc += branch(acc >= insn.K, insn)
+		default:
+			t.Fatalf("unexpected instruction %#x at %d", insn.Code, pc)
+		}
+	}
+
+	t.Fatal("program ran off the end without returning")
+
+	return 0
+}
+
+func branch(cond bool, insn unix.SockFilter) int {
+	if cond {
+		return int(insn.Jt)
+	}
+
+	return int(insn.Jf)
+}
+
+func compile(t *testing.T, profile *seccomp.Profile) []unix.SockFilter {
+	t.Helper()
+
+	if seccomp.NativeArch == 0 {
+		t.Skip("seccomp is not supported on this architecture")
+	}
+
+	program, err := seccomp.Compile(profile)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	if len(program) > unix.BPF_MAXINSNS {
+		t.Fatalf("program has %d instructions, more than the kernel accepts", len(program))
+	}
+
+	return program
+}
+
+func syscallNumber(t *testing.T, name string) uint32 {
+	t.Helper()
+
+	nr, ok := seccomp.SyscallNumbers()[name]
+	if !ok {
+		t.Fatalf("syscall %s is unknown", name)
+	}
+
+	return nr
+}
+
+func errnoRet(errno unix.Errno) *uint {
+	value := uint(errno)
+
+	return &value
+}
+
+func TestCompilePrologue(t *testing.T) {
+	t.Parallel()
+
+	program := compile(t, &seccomp.Profile{DefaultAction: seccomp.ActAllow})
+
+	want := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 4},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, K: seccomp.NativeArch},
+		{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_KILL_PROCESS},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 0},
+	}
+
+	if seccomp.X32SyscallBit != 0 {
+		want = append(want,
+			unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jf: 1, K: seccomp.X32SyscallBit},
+			unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)},
+		)
+	}
+
+	want = append(want, unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ALLOW})
+
+	if !slices.Equal(program, want) {
+		t.Errorf("Compile() = %+v, want %+v", program, want)
+	}
+
+	getpid := syscallNumber(t, "getpid")
+
+	if got := run(t, program, seccompData{nr: getpid, arch: unix.AUDIT_ARCH_I386}); got != unix.SECCOMP_RET_KILL_PROCESS {
+		t.Errorf("foreign architecture returned %#x, want SECCOMP_RET_KILL_PROCESS", got)
+	}
+
+	if seccomp.X32SyscallBit != 0 {
+		data := seccompData{nr: getpid | seccomp.X32SyscallBit, arch: seccomp.NativeArch}
+		if got := run(t, program, data); got != unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS) {
+			t.Errorf("x32 syscall returned %#x, want ENOSYS", got)
+		}
+	}
+}
+
+func TestCompileActions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		action   seccomp.Action
+		errnoRet *uint
+		want     uint32
+	}{
+		{name: "allow", action: seccomp.ActAllow, want: unix.SECCOMP_RET_ALLOW},
+		{name: "kill", action: seccomp.ActKill, want: unix.SECCOMP_RET_KILL_THREAD},
+		{name: "kill thread", action: seccomp.ActKillThread, want: unix.SECCOMP_RET_KILL_THREAD},
+		{name: "kill process", action: seccomp.ActKillProcess, want: unix.SECCOMP_RET_KILL_PROCESS},
+		{name: "trap", action: seccomp.ActTrap, want: unix.SECCOMP_RET_TRAP},
+		{name: "errno defaults to EPERM", action: seccomp.ActErrno, want: unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)},
+		{name: "errno", action: seccomp.ActErrno, errnoRet: errnoRet(unix.ENOSYS), want: unix.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)},
+		{name: "trace", action: seccomp.ActTrace, errnoRet: errnoRet(1), want: unix.SECCOMP_RET_TRACE | 1},
+		{name: "log", action: seccomp.ActLog, want: unix.SECCOMP_RET_LOG},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" as default", func(t *testing.T) {
+			t.Parallel()
+
+			program := compile(t, &seccomp.Profile{DefaultAction: tt.action, DefaultErrnoRet: tt.errnoRet})
+
+			data := seccompData{nr: syscallNumber(t, "getpid"), arch: seccomp.NativeArch}
+			if got := run(t, program, data); got != tt.want {
+				t.Errorf("getpid returned %#x, want %#x", got, tt.want)
+			}
+		})
+
+		t.Run(tt.name+" of a rule", func(t *testing.T) {
+			t.Parallel()
+
+			program := compile(t, &seccomp.Profile{
+				DefaultAction: seccomp.ActAllow,
+				Syscalls:      []seccomp.Syscall{{Names: []string{"getpid"}, Action: tt.action, ErrnoRet: tt.errnoRet}},
+			})
+
+			data := seccompData{nr: syscallNumber(t, "getpid"), arch: seccomp.NativeArch}
+			if got := run(t, program, data); got != tt.want {
+				t.Errorf("getpid returned %#x, want %#x", got, tt.want)
+			}
+
+			data.nr = syscallNumber(t, "getppid")
+			if got := run(t, program, data); got != unix.SECCOMP_RET_ALLOW {
+				t.Errorf("getppid returned %#x, want SECCOMP_RET_ALLOW", got)
+			}
+		})
+	}
+}
+
+func TestCompileOperators(t *testing.T) {
+	t.Parallel()
+
+	const (
+		high  = uint64(1) << 32
+		value = high | 5
+	)
+
+	tests := []struct {
+		name     string
+		op       seccomp.Operator
+		value    uint64
+		valueTwo uint64
+		arg      uint64
+		want     bool
+	}{
+		{name: "eq equal", op: seccomp.OpEqualTo, value: value, arg: value, want: true},
+		{name: "eq low word only", op: seccomp.OpEqualTo, value: value, arg: 5, want: false},
+		{name: "eq other low word", op: seccomp.OpEqualTo, value: value, arg: high | 6, want: false},
+		{name: "ne equal", op: seccomp.OpNotEqual, value: value, arg: value, want: false},
+		{name: "ne low word only", op: seccomp.OpNotEqual, value: value, arg: 5, want: true},
+		{name: "ne other low word", op: seccomp.OpNotEqual, value: value, arg: high | 6, want: true},
+		{name: "gt greater low word", op: seccomp.OpGreaterThan, value: value, arg: high | 6, want: true},
+		{name: "gt greater high word", op: seccomp.OpGreaterThan, value: value, arg: 2 * high, want: true},
+		{name: "gt equal", op: seccomp.OpGreaterThan, value: value, arg: value, want: false},
+		{name: "gt less high word", op: seccomp.OpGreaterThan, value: value, arg: 6, want: false},
+		{name: "ge equal", op: seccomp.OpGreaterEqual, value: value, arg: value, want: true},
+		{name: "ge greater high word", op: seccomp.OpGreaterEqual, value: value, arg: 2 * high, want: true},
+		{name: "ge less low word", op: seccomp.OpGreaterEqual, value: value, arg: high | 4, want: false},
+		{name: "lt less low word", op: seccomp.OpLessThan, value: value, arg: high | 4, want: true},
+		{name: "lt less high word", op: seccomp.OpLessThan, value: value, arg: 6, want: true},
+		{name: "lt equal", op: seccomp.OpLessThan, value: value, arg: value, want: false},
+		{name: "lt greater high word", op: seccomp.OpLessThan, value: value, arg: 2 * high, want: false},
+		{name: "le equal", op: seccomp.OpLessEqual, value: value, arg: value, want: true},
+		{name: "le less high word", op: seccomp.OpLessEqual, value: value, arg: 6, want: true},
+		{name: "le greater low word", op: seccomp.OpLessEqual, value: value, arg: high | 6, want: false},
+		{name: "masked eq", op: seccomp.OpMaskedEqual, value: 0xff_0000_00ff, valueTwo: 0x12_0000_0034, arg: 0xffff_ff12_ffff_ff34, want: true},
+		{name: "masked eq other high word", op: seccomp.OpMaskedEqual, value: 0xff_0000_00ff, valueTwo: 0x12_0000_0034, arg: 0x13_0000_0034, want: false},
+		{name: "masked eq other low word", op: seccomp.OpMaskedEqual, value: 0xff_0000_00ff, valueTwo: 0x12_0000_0034, arg: 0x12_0000_0035, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The third argument is inspected to check its offset, and the others are filled with the value not to match.
+			program := compile(t, &seccomp.Profile{
+				DefaultAction: seccomp.ActAllow,
+				Syscalls: []seccomp.Syscall{{
+					Names:  []string{"write"},
+					Action: seccomp.ActErrno,
+					Args:   []seccomp.Arg{{Index: 2, Value: tt.value, ValueTwo: tt.valueTwo, Op: tt.op}},
+				}},
+			})
+
+			data := seccompData{nr: syscallNumber(t, "write"), arch: seccomp.NativeArch}
+			for i := range data.args {
+				data.args[i] = ^tt.arg
+			}
+
+			data.args[2] = tt.arg
+
+			want := uint32(unix.SECCOMP_RET_ALLOW)
+			if tt.want {
+				want = unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+			}
+
+			if got := run(t, program, data); got != want {
+				t.Errorf("write returned %#x, want %#x", got, want)
+			}
+		})
+	}
+}
+
+func TestCompileRuleOrder(t *testing.T) {
+	t.Parallel()
+
+	program := compile(t, &seccomp.Profile{
+		DefaultAction: seccomp.ActAllow,
+		Syscalls: []seccomp.Syscall{
+			{Names: []string{"getpid"}, Action: seccomp.ActErrno, ErrnoRet: errnoRet(1), Args: []seccomp.Arg{{Op: seccomp.OpEqualTo, Value: 1}}},
+			{Names: []string{"getpid", "unknown_syscall"}, Action: seccomp.ActErrno, ErrnoRet: errnoRet(2)},
+			{Names: []string{"getpid", "getppid"}, Action: seccomp.ActTrap},
+		},
+	})
+
+	tests := []struct {
+		name string
+		data seccompData
+		want uint32
+	}{
+		{name: "first rule", data: seccompData{nr: syscallNumber(t, "getpid"), args: [6]uint64{1}}, want: unix.SECCOMP_RET_ERRNO | 1},
+		{name: "arguments not met", data: seccompData{nr: syscallNumber(t, "getpid")}, want: unix.SECCOMP_RET_ERRNO | 2},
+		{name: "later rule", data: seccompData{nr: syscallNumber(t, "getppid")}, want: unix.SECCOMP_RET_TRAP},
+		{name: "default", data: seccompData{nr: syscallNumber(t, "read")}, want: unix.SECCOMP_RET_ALLOW},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tt.data.arch = seccomp.NativeArch
+			if got := run(t, program, tt.data); got != tt.want {
+				t.Errorf("returned %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileLongProgram(t *testing.T) {
+	t.Parallel()
+
+	names := []string{}
+	for name := range seccomp.SyscallNumbers() {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	// Each rule takes several instructions, so the program gets longer than a conditional jump can reach.
+	const ruleCount = 100
+
+	profile := &seccomp.Profile{DefaultAction: seccomp.ActAllow}
+
+	for i, name := range names[:ruleCount] {
+		profile.Syscalls = append(profile.Syscalls, seccomp.Syscall{
+			Names:    []string{name},
+			Action:   seccomp.ActErrno,
+			ErrnoRet: errnoRet(unix.Errno(i + 1)),
+			Args:     []seccomp.Arg{{Op: seccomp.OpMaskedEqual, Value: 0xff, ValueTwo: uint64(i)}},
+		})
+	}
+
+	program := compile(t, profile)
+	if len(program) <= 2*ruleCount {
+		t.Fatalf("program has only %d instructions", len(program))
+	}
+
+	for _, i := range []int{0, ruleCount / 2, ruleCount - 1} {
+		data := seccompData{nr: syscallNumber(t, names[i]), arch: seccomp.NativeArch, args: [6]uint64{uint64(i)}}
+		if got, want := run(t, program, data), unix.SECCOMP_RET_ERRNO|uint32(i+1); got != want {
+			t.Errorf("%s returned %#x, want %#x", names[i], got, want)
+		}
+
+		data.args[0] = uint64(i) + 1
+		if got := run(t, program, data); got != unix.SECCOMP_RET_ALLOW {
+			t.Errorf("%s with another argument returned %#x, want SECCOMP_RET_ALLOW", names[i], got)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	t.Parallel()
+
+	tooManyArgs := make([]seccomp.Arg, 50)
+	for i := range tooManyArgs {
+		tooManyArgs[i] = seccomp.Arg{Op: seccomp.OpMaskedEqual, Value: 1, ValueTwo: 1}
+	}
+
+	tests := []struct {
+		name    string
+		profile *seccomp.Profile
+		wantErr error
+	}{
+		{
+			name:    "unknown default action",
+			profile: &seccomp.Profile{DefaultAction: "SCMP_ACT_UNKNOWN"},
+			wantErr: seccomp.ErrUnsupportedAction,
+		},
+		{
+			name: "unknown operator",
+			profile: &seccomp.Profile{DefaultAction: seccomp.ActAllow, Syscalls: []seccomp.Syscall{
+				{Names: []string{"getpid"}, Action: seccomp.ActErrno, Args: []seccomp.Arg{{Op: "SCMP_CMP_UNKNOWN"}}},
+			}},
+			wantErr: seccomp.ErrUnsupportedOperator,
+		},
+		{
+			name: "argument index out of range",
+			profile: &seccomp.Profile{DefaultAction: seccomp.ActAllow, Syscalls: []seccomp.Syscall{
+				{Names: []string{"getpid"}, Action: seccomp.ActErrno, Args: []seccomp.Arg{{Index: 6, Op: seccomp.OpEqualTo}}},
+			}},
+			wantErr: seccomp.ErrInvalidArgIndex,
+		},
+		{
+			name: "rule beyond jumps",
+			profile: &seccomp.Profile{DefaultAction: seccomp.ActAllow, Syscalls: []seccomp.Syscall{
+				{Names: []string{"getpid"}, Action: seccomp.ActErrno, Args: tooManyArgs},
+			}},
+			wantErr: seccomp.ErrRuleTooLarge,
+		},
+		{
+			name:    "foreign architecture",
+			profile: &seccomp.Profile{DefaultAction: seccomp.ActAllow, Architectures: []string{seccomp.NativeArchName, "SCMP_ARCH_X86"}},
+			wantErr: seccomp.ErrForeignArch,
+		},
+		{
+			name:    "native architecture",
+			profile: &seccomp.Profile{DefaultAction: seccomp.ActAllow, Architectures: []string{seccomp.NativeArchName}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if seccomp.NativeArch == 0 {
+				t.Skip("seccomp is not supported on this architecture")
+			}
+
+			if _, err := seccomp.Compile(tt.profile); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Compile() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package seccomp
+
+import "golang.org/x/sys/unix"
+
+// DefaultProfileName is the name to refer to DefaultProfile, following Kubernetes.
+const DefaultProfileName = "runtime/default"
+
+// DefaultProfile returns a profile that allows everything except syscalls dangerous to the host,
+// modeled on the syscalls the default profile of Docker denies.
+func DefaultProfile() *Profile {
+	enosys := uint(unix.ENOSYS)
+
+	return &Profile{
+		DefaultAction: ActAllow,
+		Syscalls: []Syscall{
+			{
+				// clone(2) is allowed only if it doesn't create namespaces.
+				Names:  []string{"clone"},
+				Action: ActAllow,
+				Args:   []Arg{{Index: 0, Value: namespaceFlags, ValueTwo: 0, Op: OpMaskedEqual}},
+			},
+			{
+				Names: []string{
+					"acct", "add_key", "bpf", "clock_adjtime", "clock_settime", "clone", "create_module",
+					"delete_module", "finit_module", "fsconfig", "fsmount", "fsopen", "fspick", "get_kernel_syms",
+					"get_mempolicy", "init_module", "ioperm", "iopl", "kcmp", "kexec_file_load", "kexec_load", "keyctl",
+					"lookup_dcookie", "mbind", "mount", "mount_setattr", "move_mount", "move_pages", "name_to_handle_at",
+					"nfsservctl", "open_by_handle_at", "open_tree", "perf_event_open", "pivot_root", "process_vm_readv",
+					"process_vm_writev", "ptrace", "query_module", "quotactl", "reboot", "request_key", "set_mempolicy",
+					"setns", "settimeofday", "swapoff", "swapon", "sysfs", "_sysctl", "umount", "umount2", "unshare",
+					"uselib", "userfaultfd", "ustat", "vm86", "vm86old",
+				},
+				Action: ActErrno,
+			},
+			{
+				// The arguments of clone3(2) can't be inspected, so make libc fall back to clone(2).
+				Names:    []string{"clone3"},
+				Action:   ActErrno,
+				ErrnoRet: &enosys,
+			},
+		},
+	}
+}
+
+const namespaceFlags = unix.CLONE_NEWNS | unix.CLONE_NEWUTS | unix.CLONE_NEWIPC | unix.CLONE_NEWUSER |
+	unix.CLONE_NEWPID | unix.CLONE_NEWNET | unix.CLONE_NEWCGROUP
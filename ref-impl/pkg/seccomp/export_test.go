@@ -0,0 +1,12 @@
+package seccomp
+
+// The compiled programs depend on the architecture, which the tests need to know.
+const (
+	NativeArch     = nativeArch
+	NativeArchName = nativeArchName
+	X32SyscallBit  = x32SyscallBit
+)
+
+func SyscallNumbers() map[string]uint32 {
+	return syscallNumbers()
+}
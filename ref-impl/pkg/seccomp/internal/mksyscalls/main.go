@@ -0,0 +1,125 @@
+// mksyscalls generates syscall_linux_<arch>.go of the seccomp package in the current directory,
+// which maps every syscall name to the number golang.org/x/sys/unix defines for the architecture.
+//
+//	go run ./internal/mksyscalls ARCH...
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/k1LoW/errors"
+)
+
+const (
+	outputPermission = 0o644
+
+	header = `// Code generated by mksyscalls; DO NOT EDIT.
+
+package seccomp
+
+import "golang.org/x/sys/unix"
+
+// syscallNumbers maps syscall names to the numbers golang.org/x/sys/unix defines for linux/%s.
+//
+//nolint:funlen // generated table of every syscall
+func syscallNumbers() map[string]uint32 {
+	return map[string]uint32{
+`
+	footer = `	}
+}
+`
+)
+
+func main() {
+	if err := generate(os.Args[1:]); err != nil {
+		log.Fatalln(errors.StackTraces(err))
+	}
+}
+
+func generate(archs []string) error {
+	// The numbers come from the version of golang.org/x/sys the module requires.
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "golang.org/x/sys").Output()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dir := filepath.Join(strings.TrimSpace(string(out)), "unix")
+
+	for _, arch := range archs {
+		names, err := syscallConstants(filepath.Join(dir, "zsysnum_linux_"+arch+".go"))
+		if err != nil {
+			return err
+		}
+
+		if err := writeTable(arch, names); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syscallConstants returns the names of the SYS_* constants declared in the file, in the order of the declarations.
+func syscallConstants(path string) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	names := []string{}
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			value, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+
+			for _, name := range value.Names {
+				if strings.HasPrefix(name.Name, "SYS_") {
+					names = append(names, name.Name)
+				}
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func writeTable(arch string, names []string) error {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, header, arch)
+
+	for _, name := range names {
+		fmt.Fprintf(buf, "\t\t%q: unix.%s,\n", strings.ToLower(strings.TrimPrefix(name, "SYS_")), name)
+	}
+
+	buf.WriteString(footer)
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.WriteFile("syscall_linux_"+arch+".go", src, outputPermission); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package seccomp
+
+import (
+	"unsafe"
+
+	"github.com/k1LoW/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Load installs the filter to all threads of the calling process.
+// The caller needs either CAP_SYS_ADMIN or no_new_privs set.
+func Load(filter []unix.SockFilter) error {
+	program := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+
+	// Go programs are multi-threaded, so TSYNC is required to cover the thread that calls execve(2) as well.
+	if _, _, errno := unix.Syscall(
+		unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER, unix.SECCOMP_FILTER_FLAG_TSYNC, uintptr(unsafe.Pointer(&program)),
+	); errno != 0 {
+		return errors.WithStack(errno)
+	}
+
+	return nil
+}
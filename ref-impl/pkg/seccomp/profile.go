@@ -0,0 +1,53 @@
+package seccomp
+
+// Profile is a seccomp profile, in the form of linux.seccomp in the OCI runtime spec.
+type Profile struct {
+	DefaultAction Action `json:"defaultAction"`
+	// DefaultErrnoRet is the errno returned by SCMP_ACT_ERRNO as the default action. EPERM if nil.
+	DefaultErrnoRet *uint `json:"defaultErrnoRet,omitempty"`
+	// Architectures may only list the native architecture like "SCMP_ARCH_X86_64". The others are always killed.
+	Architectures []string  `json:"architectures,omitempty"`
+	Syscalls      []Syscall `json:"syscalls,omitempty"`
+}
+
+// Syscall is a rule for syscalls. When several rules match a syscall, the first one wins.
+type Syscall struct {
+	Names    []string `json:"names"`
+	Action   Action   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
+	// Args are conditions on the arguments, all of which must be met.
+	Args []Arg `json:"args,omitempty"`
+}
+
+type Arg struct {
+	Index    uint     `json:"index"`
+	Value    uint64   `json:"value"`
+	ValueTwo uint64   `json:"valueTwo,omitempty"`
+	Op       Operator `json:"op"`
+}
+
+type Action string
+
+const (
+	ActKill        Action = "SCMP_ACT_KILL"
+	ActKillProcess Action = "SCMP_ACT_KILL_PROCESS"
+	ActKillThread  Action = "SCMP_ACT_KILL_THREAD"
+	ActTrap        Action = "SCMP_ACT_TRAP"
+	ActErrno       Action = "SCMP_ACT_ERRNO"
+	ActTrace       Action = "SCMP_ACT_TRACE"
+	ActAllow       Action = "SCMP_ACT_ALLOW"
+	ActLog         Action = "SCMP_ACT_LOG"
+)
+
+type Operator string
+
+const (
+	OpNotEqual     Operator = "SCMP_CMP_NE"
+	OpLessThan     Operator = "SCMP_CMP_LT"
+	OpLessEqual    Operator = "SCMP_CMP_LE"
+	OpEqualTo      Operator = "SCMP_CMP_EQ"
+	OpGreaterEqual Operator = "SCMP_CMP_GE"
+	OpGreaterThan  Operator = "SCMP_CMP_GT"
+	// OpMaskedEqual is met when the argument masked with Value equals ValueTwo.
+	OpMaskedEqual Operator = "SCMP_CMP_MASKED_EQ"
+)